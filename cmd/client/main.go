@@ -2,11 +2,15 @@ package main
 
 import (
 	"dyndns/pkg/client"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/logging"
+	"dyndns/pkg/server"
 	"errors"
 	"fmt"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/urfave/cli/v2"
-	"log"
+	"log/slog"
+	"net"
 	"os"
 )
 
@@ -17,6 +21,20 @@ func main() {
 		Description:          "Client for Dynamic DNS",
 		Usage:                "Client for Dynamic DNS",
 		EnableBashCompletion: true,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "log-format", EnvVars: []string{"DYNDNS_LOG_FORMAT"}, Value: logging.FormatText, Usage: "Log format: text or json"},
+			&cli.StringFlag{Name: "log-level", EnvVars: []string{"DYNDNS_LOG_LEVEL"}, Value: "info", Usage: "Minimum log level: debug, info, warn or error"},
+			&cli.StringFlag{Name: "log-sink", EnvVars: []string{"DYNDNS_LOG_SINK"}, Value: logging.SinkStderr, Usage: "Where to write the log: stderr, stdout, syslog or journald"},
+		},
+		Before: func(context *cli.Context) error {
+			_, err := logging.Setup(logging.Options{
+				Format: context.String("log-format"),
+				Level:  context.String("log-level"),
+				Sink:   context.String("log-sink"),
+				Tag:    "dyndns-client",
+			})
+			return err
+		},
 		Commands: []*cli.Command{
 			{
 				Name:        "list-providers",
@@ -44,7 +62,7 @@ func main() {
 
 					t.Render()
 
-					log.Printf("[DynDNS Client] Usage: dyndns-client update --host <host> [--username <username>] [--password <password>] [--ip-provider <ip-provider>]")
+					slog.Info("Usage: dyndns-client update -- --server-url <server-url> [--username <username>] [--password <password>] [--ip-provider <ip-provider>]")
 
 					return nil
 				},
@@ -52,7 +70,7 @@ func main() {
 			{
 				Name:        "update",
 				Args:        true,
-				ArgsUsage:   `-- --server-url <server-url> [--username <username>] [--password <password>] [--ip-provider <ip-provider>]`,
+				ArgsUsage:   `-- --server-url <server-url> [--username <username>] [--password <password>] [--ip-provider <ip-provider> | --server-detect]`,
 				Description: "Grabs the IP address and updates the DNS records",
 				Usage:       "Grabs the IP address and updates the DNS records",
 				Action: func(context *cli.Context) error {
@@ -63,7 +81,7 @@ func main() {
 
 					if err != nil {
 						if errors.Is(err, client.ArgNotFoundError) {
-							log.Printf("[DynDNS Client] Error: Server url not found. Please specify your server url by using the --server-url flag")
+							slog.Error("Server url not found. Please specify your server url by using the --server-url flag")
 							return nil
 						}
 					}
@@ -86,92 +104,86 @@ func main() {
 						auth = ""
 					}
 
-					ipGrabber := client.NewIpGrabber(nil)
+					_, err = args.Get("server-detect")
+					serverDetect := err == nil
 
-					grabberHostname, err := args.Get("ip-provider")
+					var v4Address, v6Address *net.IP
+					var result *server.UpdateResult
 
-					if err != nil {
-						if errors.Is(err, client.ArgNotFoundError) {
-							log.Printf("[DynDNS Client] Error: ip-provider not found. Please specify your ip-provider by using the --ip-provider flag. Using default provider.")
-							grabberHostname = "icanhazipcom"
+					caller := client.NewRemoteApiCaller()
+
+					if serverDetect {
+						slog.Info("Letting the server detect the IP address")
+
+						result, err = caller.CallDetect(host, auth)
+
+						if err == nil && result != nil {
+							v4Address = detectedAddress(result.V4)
+							v6Address = detectedAddress(result.V6)
+
+							if v4Address == nil && v6Address == nil {
+								slog.Error("The server could not use the address of the request", "v4_error", resultError(result.V4), "v6_error", resultError(result.V6))
+							}
 						}
-					}
+					} else {
+						ipGrabber := client.NewIpGrabber(nil)
 
-					grabberHosts := client.IPGrabberOptions[grabberHostname]
+						grabberHostname, err := args.Get("ip-provider")
 
-					if grabberHosts == nil {
-						log.Printf("[DynDNS Client] Error: ip-provider \"%s\" not found. Please specify your ip-provider by using the --ip-provider flag. Using default provider.", grabberHostname)
-						grabberHosts = client.IPGrabberOptions["icanhazipcom"]
-					}
+						if err != nil {
+							if errors.Is(err, client.ArgNotFoundError) {
+								slog.Warn("ip-provider not found. Please specify your ip-provider by using the --ip-provider flag. Using default provider.")
+								grabberHostname = "icanhazipcom"
+							}
+						}
 
-					ipGrabber.SetHosts(grabberHosts)
+						grabberHosts := client.IPGrabberOptions[grabberHostname]
 
-					v4Address, err := ipGrabber.GrabV4()
+						if grabberHosts == nil {
+							slog.Warn("ip-provider not found. Please specify your ip-provider by using the --ip-provider flag. Using default provider.", "ip_provider", grabberHostname)
+							grabberHosts = client.IPGrabberOptions["icanhazipcom"]
+						}
 
-					if err != nil {
-						log.Printf("[DynDNS Client] Failed to retrieve IPv4 address: %v", err)
-					}
+						ipGrabber.SetHosts(grabberHosts)
 
-					v6Address, err := ipGrabber.GrabV6()
+						v4Address, err = ipGrabber.GrabV4()
 
-					if err != nil {
-						log.Printf("[DynDNS Client] Failed to retrieve IPv6 address: %v", err)
-					}
+						if err != nil {
+							slog.Warn("Failed to retrieve IPv4 address", "ip_provider", grabberHostname, "error", err)
+						}
 
-					caller := client.NewRemoteApiCaller()
+						v6Address, err = ipGrabber.GrabV6()
+
+						if err != nil {
+							slog.Warn("Failed to retrieve IPv6 address", "ip_provider", grabberHostname, "error", err)
+						}
 
-					result, err := caller.Call(host, v4Address, v6Address, auth)
+						result, err = caller.Call(host, v4Address, v6Address, auth)
+					}
 
 					if err != nil {
 
 						if errors.Is(err, client.ErrUnauthorized) {
-							log.Printf("[DynDNS Client] Unauthorized. Please check your credentials.")
+							slog.Error("Unauthorized. Please check your credentials.")
 						}
 
 						if errors.Is(err, client.ErrInternalServerError) {
-							log.Printf("[DynDNS Client] Internal server error. Please try again later.")
+							slog.Error("Internal server error. Please try again later.")
 						}
 
 						if !errors.Is(err, client.ErrUnauthorized) && !errors.Is(err, client.ErrInternalServerError) {
-							log.Printf("[DynDNS Client] Error calling server: %v", err)
+							slog.Error("Error calling server", "error", err)
 						}
 						return nil
 					}
 
 					if result == nil && err == nil {
-						log.Printf("[DynDNS Client] Error calling server: result is nil")
+						slog.Error("Error calling server: result is nil")
 						return errors.New("result is nil")
 					}
 
-					log.Printf("[DynDNS Client] Successfully updated DNS records for: %s", result.Name)
-
-					if v4Address != nil {
-						if result.V4.Success {
-							if result.V4.Created {
-								log.Printf("[DynDNS Client] Successfully created IPv4 record: %s", v4Address.String())
-							} else {
-								log.Printf("[DynDNS Client] Successfully updated IPv4 record: %s", v4Address.String())
-							}
-						} else {
-							log.Printf("[DynDNS Client] Failed to update IPv4 record: %s. Error: %s", v4Address.String(), result.V4.Error)
-						}
-					} else {
-						log.Printf("[DynDNS Client] No IPv4 address provided. Skipping IPv4 update.")
-					}
-
-					if v6Address != nil {
-						if result.V6.Success {
-							if result.V6.Created {
-								log.Printf("[DynDNS Client] Successfully created IPv6 record: %s", v6Address.String())
-							} else {
-								log.Printf("[DynDNS Client] Successfully updated IPv6 record: %s", v6Address.String())
-							}
-						} else {
-							log.Printf("[DynDNS Client] Failed to update IPv6 record: %s. Error: %s", v6Address.String(), result.V6.Error)
-						}
-					} else {
-						log.Printf("[DynDNS Client] No IPv6 address provided. Skipping IPv6 update.")
-					}
+					logRecord(result.Name, "A", v4Address, result.V4)
+					logRecord(result.Name, "AAAA", v6Address, result.V6)
 
 					return nil
 				},
@@ -180,7 +192,50 @@ func main() {
 	}).Run(os.Args)
 
 	if err != nil {
-		log.Printf("[DynDNS Client] Error running client: %v", err)
+		slog.Error("Error running client", "error", err)
+	}
+
+}
+
+// logRecord logs the outcome of one record of the update. address is nil if the client had none for the family.
+func logRecord(hostname string, rrType string, address *net.IP, result *dns.UpdateResult) {
+	if address == nil {
+		slog.Info("No address provided, skipping the record", "hostname", hostname, "rr_type", rrType)
+		return
+	}
+
+	logger := slog.With("hostname", hostname, "rr_type", rrType, "ip", address.String())
+
+	switch {
+	case result == nil || !result.Success:
+		logger.Error("Failed to update record", "outcome", "error", "error", resultError(result))
+	case result.Created:
+		logger.Info("Successfully created record", "outcome", "created")
+	case result.Unchanged:
+		logger.Info("Record already up to date", "outcome", "unchanged")
+	default:
+		logger.Info("Successfully updated record", "outcome", "updated")
+	}
+}
+
+// detectedAddress returns the address the server filled in, nil if it had none for the family.
+func detectedAddress(result *dns.UpdateResult) *net.IP {
+	if result == nil || result.Value == "" {
+		return nil
 	}
 
+	ip := net.ParseIP(result.Value)
+
+	if ip == nil {
+		return nil
+	}
+
+	return &ip
+}
+
+func resultError(result *dns.UpdateResult) string {
+	if result == nil || result.Error == nil {
+		return "-"
+	}
+	return result.Error.Error()
 }
@@ -1,68 +1,137 @@
 package main
 
 import (
+	"context"
+	"dyndns/pkg/auth"
+	"dyndns/pkg/config"
 	"dyndns/pkg/dns"
+	"dyndns/pkg/history"
+	"dyndns/pkg/logging"
+	"dyndns/pkg/metrics"
+	"dyndns/pkg/ratelimit"
+	"dyndns/pkg/server/realip"
 	"dyndns/pkg/server/routes"
 	"dyndns/pkg/utils"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-var bindAddress string
-var auth string
-var authFile string
-var dnsZoneName string
-var domainName string
-var projectID string
-var dynDNSService dns.DynDNSService
+// options holds the raw flag values after the environment variables and the config file were applied.
+type options struct {
+	flags           *flag.FlagSet
+	flagEnvs        map[string][]string
+	err             error
+	configFile      string
+	bindAddress     string
+	metricsAddress  string
+	ipSource        string
+	trustedProxies  string
+	proxyProtocol   string
+	shutdownTimeout string
+	readyInterval   string
+	historyFile     string
+	historyKeep     string
+	readLimit       string
+	writeLimit      string
+	logFormat       string
+	logLevel        string
+	logSink         string
+	basicAuth       string
+	usersFile       string
+	provider        string
+	providerOptions map[string]*string
+	domainName      string
+	zone            string
+	hostnames       string
+	ttl             string
+	minTTL          string
+	maxTTL          string
+}
 
-func init() {
-	flag.StringVar(&bindAddress, "bind-address", utils.OsEnv("DYNDNS_BIND_ADDRESS", ":8080"), "Bind address for the server")
-	flag.StringVar(&auth, "auth", os.Getenv("DYNDNS_AUTH"), "Basic Auth username:password")
-	flag.StringVar(&authFile, "auth-file", utils.OsEnv("DYNDNS_AUTH_FILE", "google.json"), "Path to file containing the Google Cloud credentials")
-	flag.StringVar(&dnsZoneName, "dns-zone-name", os.Getenv("DYNDNS_DNS_ZONE_NAME"), "DNS zone name")
-	flag.StringVar(&domainName, "domain-name", os.Getenv("DYNDNS_DOMAIN_NAME"), "Domain name")
-	flag.StringVar(&projectID, "project-id", os.Getenv("DYNDNS_PROJECT_ID"), "Google Cloud project ID")
-	flag.Parse()
+// settings is everything the server derives from its options. A reload builds a new one and swaps it in as a whole,
+// requests keep using the settings they started with.
+type settings struct {
+	bindAddress     string
+	metricsAddress  string
+	trustedNetworks []*net.IPNet
+	ipExtractor     echo.IPExtractor
+	proxyProtocol   bool
+	shutdownTimeout time.Duration
+	historyFile     string
+	historyKeep     time.Duration
+	logFormat       string
+	logLevel        string
+	logSink         string
+	provider        string
+	providerConfig  *dns.ProviderConfig
+	credentials     string
+	service         *activeService
+	routes          *routes.Config
+}
 
-	if dnsZoneName == "" {
-		log.Fatal("[DynDNS Server] DNS zone name is required")
-	}
+// activeService is a DNS service with the requests using it. A reload that replaces the service retires it: new
+// requests no longer get it and it is closed once the running ones are done.
+type activeService struct {
+	service  dns.DynDNSService
+	mu       sync.Mutex
+	retired  bool
+	requests sync.WaitGroup
+}
 
-	if domainName == "" {
-		log.Fatal("[DynDNS Server] Domain name is required")
-	}
+// contextKeySettings is the echo context key under which the *settings of a request are stored.
+const contextKeySettings = "dyndns.settings"
 
-	if !strings.HasSuffix(domainName, ".") {
-		domainName = domainName + "."
-		log.Printf("[DynDNS Server] Appending '.' to domain name to get FQDN: %v", domainName)
-	}
+var current atomic.Pointer[settings]
+var logSink io.Closer
+var historyStore *history.Store
+var limiter = ratelimit.NewLimiter()
+var signals = make(chan os.Signal, 1)
 
-	if projectID == "" {
-		log.Fatal("[DynDNS Server] Google Cloud project ID is required")
-	}
+func init() {
+	// Registered first so a SIGHUP during startup is handled once the server runs instead of killing the process
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 
-	service, err := dns.NewService(authFile, projectID, dnsZoneName, domainName)
+	opts, err := parseOptions(os.Args[1:], flag.ExitOnError)
 
 	if err != nil {
-		log.Fatalf("[DynDNS Server] failed to create DNS service: %v", err)
+		logging.Fatal("Invalid options", "error", err)
+	}
+
+	if logSink, err = logging.Setup(logging.Options{Format: opts.logFormat, Level: opts.logLevel, Sink: opts.logSink, Tag: "dyndns-server"}); err != nil {
+		logging.Fatal("Failed to set up logging", "error", err)
 	}
 
-	dynDNSService = service
-	err = dynDNSService.ValidateCredentials()
+	loaded, err := loadSettings(opts, nil)
 
 	if err != nil {
-		log.Fatalf("[DynDNS Server] failed to validate credentials: %v", err)
+		logging.Fatal("Invalid configuration", "error", err)
 	}
 
-	log.Printf("[DynDNS Server] Credentials validated successfully!")
+	if loaded.historyFile != "" {
+		if historyStore, err = history.Open(loaded.historyFile, loaded.historyKeep); err != nil {
+			logging.Fatal("Failed to open history", "error", err)
+		}
 
+		loaded.routes.History = historyStore
+	}
+
+	current.Store(loaded)
 }
 
 func main() {
@@ -70,42 +139,590 @@ func main() {
 	server := echo.New()
 	server.HideBanner = true
 	server.HidePort = true
-	server.IPExtractor = echo.ExtractIPFromXFFHeader()
+	server.IPExtractor = func(r *http.Request) string {
+		return current.Load().ipExtractor(r)
+	}
 	server.Use(middleware.Recover())
 	server.Use(middleware.RequestID())
 
-	if auth != "" {
-		server.Use(middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
-			Skipper: func(c echo.Context) bool {
-				return c.Path() == "/"
-			},
-			Validator: func(username, password string, c echo.Context) (bool, error) {
-				if username+":"+password == auth {
-					return true, nil
-				}
-				return false, nil
-			},
-		}))
-	} else {
-		log.Println("[DynDNS Server] Warning: No Basic Auth credentials. Waiting 5 seconds before starting server.")
+	// The authentication, the handlers and the DNS service of a request all use the settings it started with, and a
+	// reload does not close the service until the request is done with it
+	server.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			s := acquireSettings()
+			defer s.service.release()
+
+			c.Set(contextKeySettings, s)
+			return next(c)
+		}
+	})
+
+	server.Use(middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper: func(c echo.Context) bool {
+			// /nic/update answers dyndns2 clients with its own badauth response, the probes carry no credentials
+			switch c.Path() {
+			case "/", "/nic/update", "/healthz", "/readyz":
+				return true
+			}
+			return requestSettings(c).routes.Users.Len() == 0
+		},
+		Validator: func(username, password string, c echo.Context) (bool, error) {
+			user, ok := requestSettings(c).routes.Users.Authenticate(username, password)
+			if ok {
+				c.Set(auth.ContextKeyUser, user)
+			} else {
+				routes.RequestLogger(c).Warn("Bad authentication", "user", username, "outcome", "unauthorized")
+				metrics.AuthFailure(c.Path())
+			}
+			return ok, nil
+		},
+	}))
+
+	if current.Load().routes.Users.Len() == 0 {
+		slog.Warn("No Basic Auth credentials. Waiting 5 seconds before starting server.")
 		time.Sleep(5 * time.Second)
 	}
 
 	server.GET("/", func(c echo.Context) error {
-		return c.String(http.StatusOK, "Simple DynDNS Server for Google Cloud DNS")
+		return c.String(http.StatusOK, "Simple DynDNS Server")
 	})
 
-	routes.MountDynRoute(server, &routes.Config{
+	routeConfig := func(c echo.Context) *routes.Config {
+		return requestSettings(c).routes
+	}
+
+	routes.MountDynRoute(server, routeConfig)
+	routes.MountNicRoute(server, routeConfig)
+	routes.MountHealthRoutes(server, routeConfig)
+	routes.MountHistoryRoute(server, routeConfig)
+
+	startup := current.Load()
+
+	if startup.proxyProtocol {
+		listener, err := net.Listen("tcp", startup.bindAddress)
+
+		if err != nil {
+			logging.Fatal("Failed to listen", "address", startup.bindAddress, "error", err)
+		}
+
+		server.Listener = realip.NewProxyProtocolListener(listener, startup.trustedNetworks)
+	}
+
+	var metricsServer *http.Server
+
+	if startup.metricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: startup.metricsAddress, Handler: mux}
+
+		go func() {
+			slog.Info("Serving metrics", "address", startup.metricsAddress)
+
+			err := metricsServer.ListenAndServe()
+
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logging.Fatal("Failed to start metrics server", "error", err)
+			}
+		}()
+	}
+
+	go func() {
+		slog.Info("Starting server", "address", startup.bindAddress)
+
+		err := server.Start(startup.bindAddress)
+
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("Failed to start server", "error", err)
+		}
+	}()
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reload()
+			continue
+		}
+
+		slog.Info("Shutting down", "signal", sig.String())
+		break
+	}
+
+	shutdown(server, metricsServer)
+
+}
+
+// reload rebuilds the settings from the command line, the environment, the config file and the users file. If
+// anything is invalid the current settings stay in place.
+func reload() {
+	previous := current.Load()
+
+	opts, err := parseOptions(os.Args[1:], flag.ContinueOnError)
+
+	if err == nil {
+		var next *settings
+		next, err = loadSettings(opts, previous)
+
+		if err == nil {
+			current.Store(next)
+
+			if next.logLevel != previous.logLevel {
+				_ = logging.SetLevel(next.logLevel) // validated by loadSettings
+			}
+
+			if next.service != previous.service {
+				go previous.service.retire()
+			}
+
+			if next.bindAddress != previous.bindAddress || next.proxyProtocol != previous.proxyProtocol {
+				slog.Warn("bind-address and proxy-protocol only change on restart")
+			}
+
+			if next.metricsAddress != previous.metricsAddress {
+				slog.Warn("metrics-address only changes on restart")
+			}
+
+			if next.historyFile != previous.historyFile || next.historyKeep != previous.historyKeep {
+				slog.Warn("history-file and history-retention only change on restart")
+			}
+
+			if next.logFormat != previous.logFormat || next.logSink != previous.logSink {
+				slog.Warn("log-format and log-sink only change on restart")
+			}
+
+			slog.Info("Configuration reloaded")
+			return
+		}
+	}
+
+	slog.Error("Failed to reload configuration, keeping the current one", "error", err)
+}
+
+// shutdown stops accepting connections and waits for in-flight requests to finish, at most for the shutdown timeout.
+func shutdown(server *echo.Echo, metricsServer *http.Server) {
+	last := current.Load()
+
+	ctx, cancel := context.WithTimeout(context.Background(), last.shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Failed to drain in-flight requests", "error", err)
+	}
+
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(ctx)
+	}
+
+	closeService(last.service.service)
+
+	if historyStore != nil {
+		if err := historyStore.Close(); err != nil {
+			slog.Error("Failed to close history", "error", err)
+		}
+	}
+
+	slog.Info("Server stopped")
+
+	_ = logSink.Close()
+}
+
+// acquireSettings returns the current settings with their DNS service held for a request. If a reload retired the
+// service meanwhile, the settings replacing it are already stored and taken on the next attempt.
+func acquireSettings() *settings {
+	for {
+		s := current.Load()
+
+		if s.service.acquire() {
+			return s
+		}
+	}
+}
+
+func requestSettings(c echo.Context) *settings {
+	return c.Get(contextKeySettings).(*settings)
+}
+
+// acquire counts a request using the service, false if it is already retired.
+func (a *activeService) acquire() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.retired {
+		return false
+	}
+
+	a.requests.Add(1)
+	return true
+}
+
+func (a *activeService) release() {
+	a.requests.Done()
+}
+
+// retire stops handing the service to new requests, waits for the running ones and closes it.
+func (a *activeService) retire() {
+	a.mu.Lock()
+	a.retired = true
+	a.mu.Unlock()
+
+	a.requests.Wait()
+	closeService(a.service)
+}
+
+func closeService(service dns.DynDNSService) {
+	closer, ok := service.(io.Closer)
+
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		slog.Error("Failed to close DNS service", "error", err)
+	}
+}
+
+// parseOptions registers all flags on a fresh flag set, parses args and applies the config file. The environment
+// variables and secret files are read again on every call.
+func parseOptions(args []string, errorHandling flag.ErrorHandling) (*options, error) {
+	o := &options{
+		flags:           flag.NewFlagSet(os.Args[0], errorHandling),
+		flagEnvs:        map[string][]string{},
+		providerOptions: map[string]*string{},
+	}
+
+	o.flags.StringVar(&o.configFile, "config", os.Getenv("DYNDNS_CONFIG"), "YAML config file, flags and environment variables take precedence over it")
+	o.envFlag(&o.bindAddress, "bind-address", "DYNDNS_BIND_ADDRESS", ":8080", "Bind address for the server")
+	o.envFlag(&o.metricsAddress, "metrics-address", "DYNDNS_METRICS_ADDRESS", "", "Bind address of the Prometheus /metrics endpoint, empty disables it")
+	o.envFlag(&o.ipSource, "ip-source", "DYNDNS_IP_SOURCE", realip.SourceDirect, "Where to take the client address from: direct, x-real-ip or xff")
+	o.envFlag(&o.trustedProxies, "trusted-proxies", "DYNDNS_TRUSTED_PROXIES", "", "Comma separated CIDRs of proxies whose address headers are trusted (default: loopback, link-local and private networks)")
+	o.envFlag(&o.proxyProtocol, "proxy-protocol", "DYNDNS_PROXY_PROTOCOL", "false", "Accept PROXY protocol v1/v2 headers from the trusted proxies")
+	o.envFlag(&o.shutdownTimeout, "shutdown-timeout", "DYNDNS_SHUTDOWN_TIMEOUT", "30s", "How long to wait for in-flight requests on SIGTERM/SIGINT")
+	o.envFlag(&o.readyInterval, "ready-check-interval", "DYNDNS_READY_CHECK_INTERVAL", "30s", "How long /readyz reuses the result of its DNS backend check")
+	o.envFlag(&o.historyFile, "history-file", "DYNDNS_HISTORY_FILE", "", "File the history of record changes is kept in, empty disables the history")
+	o.envFlag(&o.historyKeep, "history-retention", "DYNDNS_HISTORY_RETENTION", "720h", "How long history entries are kept, 0 keeps them forever")
+	o.envFlag(&o.readLimit, "rate-limit-read", "DYNDNS_RATE_LIMIT_READ", "", "Reads per client address, user and hostname, e.g. 60/m, empty disables the limit")
+	o.envFlag(&o.writeLimit, "rate-limit-write", "DYNDNS_RATE_LIMIT_WRITE", "", "Updates per client address, user and hostname, e.g. 10/m, empty disables the limit")
+	o.envFlag(&o.logFormat, "log-format", "DYNDNS_LOG_FORMAT", logging.FormatText, "Log format: text or json")
+	o.envFlag(&o.logLevel, "log-level", "DYNDNS_LOG_LEVEL", "info", "Minimum log level: debug, info, warn or error")
+	o.envFlag(&o.logSink, "log-sink", "DYNDNS_LOG_SINK", logging.SinkStderr, "Where to write the log: stderr, stdout, syslog or journald")
+	// DYNDNS_AUTH_FILE already names the Google credentials file
+	o.secretFlag(&o.basicAuth, "auth", "DYNDNS_AUTH", "DYNDNS_BASIC_AUTH_FILE", "Basic Auth username:password, may update every hostname")
+	o.envFlag(&o.usersFile, "users-file", "DYNDNS_USERS_FILE", "", "File with one username:password:hostname[,hostname...] per line")
+	o.envFlag(&o.provider, "provider", "DYNDNS_PROVIDER", "google", "DNS provider to update the records with")
+	o.envFlag(&o.domainName, "domain-name", "DYNDNS_DOMAIN_NAME", "", "Domain name")
+	o.envFlag(&o.zone, "zone", "DYNDNS_ZONE", "", "Zone all hostnames lie in (default: domain name without its first label)")
+	o.envFlag(&o.hostnames, "hostnames", "DYNDNS_HOSTNAMES", "", "Comma separated additional hostnames clients may update, names without a dot are relative to the zone. Append =TTL to override the TTL")
+	o.envFlag(&o.ttl, "ttl", "DYNDNS_TTL", "0", "Default TTL of the records in seconds, 0 uses the default of the provider")
+	o.envFlag(&o.minTTL, "min-ttl", "DYNDNS_MIN_TTL", "30", "Lowest TTL clients may request")
+	o.envFlag(&o.maxTTL, "max-ttl", "DYNDNS_MAX_TTL", "86400", "Highest TTL clients may request")
+
+	for _, p := range dns.Providers() {
+		for _, opt := range p.Options {
+			if _, exists := o.providerOptions[opt.Name]; exists {
+				continue
+			}
+
+			o.providerOptions[opt.Name] = new(string)
+			usage := fmt.Sprintf("[%s] %s", p.Name, opt.Usage)
+
+			if opt.Secret {
+				o.secretFlag(o.providerOptions[opt.Name], opt.Name, opt.Env, opt.Env+"_FILE", usage)
+			} else {
+				o.envFlag(o.providerOptions[opt.Name], opt.Name, opt.Env, opt.Default, usage)
+			}
+		}
+	}
+
+	if err := o.flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	if o.configFile != "" {
+		if err := o.applyConfigFile(o.configFile); err != nil {
+			return nil, fmt.Errorf("failed to load config file: %v", err)
+		}
+	}
+
+	return o, nil
+}
+
+// loadSettings validates the options and builds the settings from them. The DNS service of previous is reused if the
+// provider and its options did not change, otherwise a new one is created and its credentials are validated. Changed
+// options of a stateful provider are rejected instead.
+func loadSettings(o *options, previous *settings) (*settings, error) {
+	domainName := o.domainName
+
+	if domainName == "" {
+		return nil, errors.New("domain name is required")
+	}
+
+	if !strings.HasSuffix(domainName, ".") {
+		domainName = domainName + "."
+		slog.Debug("Appending '.' to domain name to get FQDN", "hostname", domainName)
+	}
+
+	zone := o.zone
+
+	if zone == "" {
+		zone = domainName[strings.Index(domainName, ".")+1:]
+	}
+
+	zone = strings.ToLower(zone)
+
+	if !strings.HasSuffix(zone, ".") {
+		zone = zone + "."
+	}
+
+	if zone == "." || (strings.ToLower(domainName) != zone && !strings.HasSuffix(strings.ToLower(domainName), "."+zone)) {
+		return nil, fmt.Errorf("domain name %v is not inside the zone %v", domainName, zone)
+	}
+
+	for name, value := range map[string]string{"ttl": o.ttl, "min-ttl": o.minTTL, "max-ttl": o.maxTTL} {
+		if parsed, err := strconv.Atoi(value); err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", name, value)
+		}
+	}
+
+	defaultTTL, _ := strconv.Atoi(o.ttl)
+	minimumTTL, _ := strconv.Atoi(o.minTTL)
+	maximumTTL, _ := strconv.Atoi(o.maxTTL)
+
+	if maximumTTL > 0 && minimumTTL > maximumTTL {
+		return nil, fmt.Errorf("min-ttl %d is greater than max-ttl %d", minimumTTL, maximumTTL)
+	}
+
+	var allowedHostnames []string
+	hostnameTTLs := map[string]int{}
+
+	for _, hostname := range strings.Split(o.hostnames, ",") {
+		if strings.TrimSpace(hostname) == "" {
+			continue
+		}
+
+		hostname, hostnameTTL, hasTTL := strings.Cut(hostname, "=")
+		hostname = auth.QualifyHostname(hostname, zone)
+
+		if hasTTL {
+			parsed, err := strconv.Atoi(strings.TrimSpace(hostnameTTL))
+
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid TTL for hostname %v: %q", hostname, hostnameTTL)
+			}
+
+			hostnameTTLs[hostname] = parsed
+		}
+
+		if hostname != zone && !strings.HasSuffix(hostname, "."+zone) {
+			return nil, fmt.Errorf("hostname %v is not inside the zone %v", hostname, zone)
+		}
+
+		allowedHostnames = append(allowedHostnames, hostname)
+	}
+
+	trustedNetworks, err := realip.ParseTrustedProxies(o.trustedProxies)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ipExtractor, err := realip.NewExtractor(o.ipSource, trustedNetworks)
+
+	if err != nil {
+		return nil, err
+	}
+
+	useProxyProtocol, err := strconv.ParseBool(o.proxyProtocol)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy-protocol: %q", o.proxyProtocol)
+	}
+
+	if useProxyProtocol && len(trustedNetworks) == 0 {
+		slog.Warn("PROXY protocol headers are accepted from every upstream. Restrict them with --trusted-proxies.")
+	}
+
+	if _, err := logging.ParseLevel(o.logLevel); err != nil {
+		return nil, err
+	}
+
+	shutdownTimeout, err := time.ParseDuration(o.shutdownTimeout)
+
+	if err != nil || shutdownTimeout < 0 {
+		return nil, fmt.Errorf("invalid shutdown-timeout: %q", o.shutdownTimeout)
+	}
+
+	readyInterval, err := time.ParseDuration(o.readyInterval)
+
+	if err != nil || readyInterval < 0 {
+		return nil, fmt.Errorf("invalid ready-check-interval: %q", o.readyInterval)
+	}
+
+	historyKeep, err := time.ParseDuration(o.historyKeep)
+
+	if err != nil || historyKeep < 0 {
+		return nil, fmt.Errorf("invalid history-retention: %q", o.historyKeep)
+	}
+
+	readLimit, err := ratelimit.ParseLimit(o.readLimit)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate-limit-read: %v", err)
+	}
+
+	writeLimit, err := ratelimit.ParseLimit(o.writeLimit)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate-limit-write: %v", err)
+	}
+
+	slog.Info("Serving hostnames", "count", len(allowedHostnames)+1, "zone", zone)
+
+	users := auth.NewStore()
+
+	if o.usersFile != "" {
+		data, err := os.ReadFile(o.usersFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read users file: %v", err)
+		}
+
+		users, err = auth.ParseUsers(data, zone)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse users file: %v", err)
+		}
+	}
+
+	if o.basicAuth != "" {
+		credentials := strings.SplitN(o.basicAuth, ":", 2)
+
+		if len(credentials) != 2 {
+			return nil, errors.New("could not parse auth into username and password, the format is username:password")
+		}
+
+		if err := users.Add(credentials[0], credentials[1], []string{"*"}); err != nil {
+			return nil, fmt.Errorf("failed to add auth user: %v", err)
+		}
+	}
+
+	selected, err := dns.GetProvider(o.provider)
+
+	if err != nil {
+		return nil, err
+	}
+
+	providerConfig := &dns.ProviderConfig{
 		DomainName: domainName,
-		CloudDNS:   dynDNSService,
-	})
+		Options:    map[string]string{},
+	}
+
+	for _, opt := range selected.Options {
+		providerConfig.Options[opt.Name] = *o.providerOptions[opt.Name]
+	}
+
+	var service *activeService
+
+	// Credentials rotated in place keep the options unchanged, so the content of the credential files is compared too
+	credentials := dns.CredentialsFingerprint(selected.Name, providerConfig)
+
+	if previous != nil && previous.provider == selected.Name && previous.providerConfig.DomainName == providerConfig.DomainName && maps.Equal(previous.providerConfig.Options, providerConfig.Options) && previous.credentials == credentials {
+		service = previous.service
+	} else if previous != nil && previous.provider == selected.Name && selected.Stateful {
+		return nil, fmt.Errorf("options of the %s provider only change on restart", selected.Name)
+	} else {
+		created, err := dns.NewProviderService(selected.Name, providerConfig)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DNS service: %v", err)
+		}
+
+		if err := created.ValidateCredentials(); err != nil {
+			closeService(created)
+			return nil, fmt.Errorf("failed to validate credentials: %v", err)
+		}
+
+		slog.Info("Credentials validated successfully", "provider", selected.Name)
+
+		service = &activeService{service: created}
+	}
 
-	log.Printf("[DynDNS Server] Starting server on %v", bindAddress)
+	return &settings{
+		bindAddress:     o.bindAddress,
+		metricsAddress:  o.metricsAddress,
+		trustedNetworks: trustedNetworks,
+		ipExtractor:     ipExtractor,
+		proxyProtocol:   useProxyProtocol,
+		shutdownTimeout: shutdownTimeout,
+		historyFile:     o.historyFile,
+		historyKeep:     historyKeep,
+		logFormat:       o.logFormat,
+		logLevel:        o.logLevel,
+		logSink:         o.logSink,
+		provider:        selected.Name,
+		providerConfig:  providerConfig,
+		credentials:     credentials,
+		service:         service,
+		routes: &routes.Config{
+			DomainName:         domainName,
+			Zone:               zone,
+			Hostnames:          allowedHostnames,
+			TTL:                defaultTTL,
+			HostnameTTLs:       hostnameTTLs,
+			MinTTL:             minimumTTL,
+			MaxTTL:             maximumTTL,
+			CloudDNS:           service.service,
+			Provider:           selected.Name,
+			Users:              users,
+			ReadyCheckInterval: readyInterval,
+			History:            historyStore,
+			Limiter:            limiter,
+			ReadLimit:          readLimit,
+			WriteLimit:         writeLimit,
+		},
+	}, nil
+}
+
+// envFlag registers a string flag that defaults to the environment variable env, or value if it is unset.
+func (o *options) envFlag(p *string, name string, env string, value string, usage string) {
+	o.flagEnvs[name] = []string{env}
+	o.flags.StringVar(p, name, utils.OsEnv(env, value), usage)
+}
+
+// secretFlag registers a string flag that defaults to the environment variable env or the content of the file named
+// by fileEnv.
+func (o *options) secretFlag(p *string, name string, env string, fileEnv string, usage string) {
+	value, err := utils.OsEnvSecret(env, fileEnv, "")
 
-	err := server.Start(bindAddress)
+	if err != nil && o.err == nil {
+		o.err = fmt.Errorf("failed to read %s: %v", fileEnv, err)
+	}
+
+	o.flagEnvs[name] = []string{env, fileEnv}
+	o.flags.StringVar(p, name, value, usage)
+}
+
+// applyConfigFile sets the flags from the config file that were given neither on the command line nor through their
+// environment variables.
+func (o *options) applyConfigFile(path string) error {
+	file, err := config.Load(path)
 
 	if err != nil {
-		log.Fatalf("[DynDNS Server] failed to start server: %v", err)
+		return err
+	}
+
+	for name := range file.Backend.Options {
+		if _, ok := o.providerOptions[name]; !ok {
+			return fmt.Errorf("%w: unknown backend option %q", config.ErrInvalidConfigFile, name)
+		}
 	}
 
+	if err := file.Apply(o.flags, o.flagEnvs); err != nil {
+		return err
+	}
+
+	slog.Info("Loaded config file", "path", path)
+
+	return nil
 }
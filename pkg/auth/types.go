@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"dyndns/pkg/ratelimit"
+	"errors"
+)
+
+var (
+	ErrInvalidUsersFile = errors.New("invalid users file")
+	ErrDuplicateUser    = errors.New("duplicate user")
+)
+
+// ContextKeyUser is the echo context key under which the authenticated *User is stored.
+const ContextKeyUser = "dyndns.user"
+
+// User is a credential together with the hostnames it may update.
+type User struct {
+	Name string
+	// Hostnames holds FQDN patterns with trailing dot. "*" matches any label, "*" alone matches every hostname.
+	Hostnames []string
+	// Limits overrides the rate limits of the server for this user.
+	Limits   ratelimit.Limits
+	password string
+}
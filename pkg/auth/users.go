@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"dyndns/pkg/ratelimit"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Store holds the users allowed to talk to the server.
+type Store struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+func NewStore() *Store {
+	return &Store{
+		users: map[string]*User{},
+	}
+}
+
+// ParseUsers reads a users file. Every non-empty line that does not start with '#' has the form
+//
+//	username:password:hostname[,hostname...][:class=limit[,class=limit]]
+//
+// The password is either plain text or a bcrypt hash ($2a$, $2b$, $2y$). Hostnames may contain globs and are taken
+// relative to zone if they contain no dot. The optional last field overrides the rate limits for the user, e.g.
+// write=30/m, see ratelimit.ParseLimits.
+func ParseUsers(data []byte, zone string) (*Store, error) {
+	store := NewStore()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// bcrypt hashes contain no ':', so the last field is always the hostname list, or the limits if it has a '='.
+		first := strings.Index(line, ":")
+		last := strings.LastIndex(line, ":")
+
+		var limits ratelimit.Limits
+
+		if last > first && strings.Contains(line[last+1:], "=") {
+			var err error
+
+			if limits, err = ratelimit.ParseLimits(line[last+1:]); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidUsersFile, lineNumber, err)
+			}
+
+			line = line[:last]
+			last = strings.LastIndex(line, ":")
+		}
+
+		if first <= 0 || first == last {
+			return nil, fmt.Errorf("%w: line %d: expected username:password:hostnames", ErrInvalidUsersFile, lineNumber)
+		}
+
+		var hostnames []string
+		for _, hostname := range strings.Split(line[last+1:], ",") {
+			if hostname = strings.TrimSpace(hostname); hostname != "" {
+				hostnames = append(hostnames, QualifyHostname(hostname, zone))
+			}
+		}
+
+		if len(hostnames) == 0 {
+			return nil, fmt.Errorf("%w: line %d: no hostnames for user %q", ErrInvalidUsersFile, lineNumber, line[:first])
+		}
+
+		user := &User{Name: line[:first], Hostnames: hostnames, Limits: limits}
+
+		if err := store.AddUser(user, line[first+1:last]); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidUsersFile, lineNumber, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Add registers a user without own rate limits. Hostnames must already be fully qualified, see QualifyHostname.
+func (s *Store) Add(name string, password string, hostnames []string) error {
+	return s.AddUser(&User{Name: name, Hostnames: hostnames}, password)
+}
+
+// AddUser registers user with the plain-text or bcrypt password. The store keeps user, it must not be changed
+// afterwards.
+func (s *Store) AddUser(user *User, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[user.Name]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateUser, user.Name)
+	}
+
+	user.password = password
+	s.users[user.Name] = user
+
+	return nil
+}
+
+// Len returns the number of users in the store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// Authenticate returns the user if the password matches.
+func (s *Store) Authenticate(name string, password string) (*User, bool) {
+	s.mu.RLock()
+	user, exists := s.users[name]
+	s.mu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	if isBcrypt(user.password) {
+		if bcrypt.CompareHashAndPassword([]byte(user.password), []byte(password)) != nil {
+			return nil, false
+		}
+		return user, true
+	}
+
+	if subtle.ConstantTimeCompare([]byte(user.password), []byte(password)) != 1 {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// MayUpdate reports whether the user is allowed to update the given FQDN.
+func (u *User) MayUpdate(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+
+	for _, pattern := range u.Hostnames {
+		if pattern == "*" {
+			return true
+		}
+
+		// path.Match lets '*' match '.', so a glob is limited to a single label by requiring the same label count.
+		if strings.Count(pattern, ".") != strings.Count(hostname, ".") {
+			continue
+		}
+
+		if matched, err := path.Match(pattern, hostname); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QualifyHostname lower-cases the hostname pattern, resolves names without a dot relative to zone and appends the
+// trailing dot. "*" is kept as is.
+func QualifyHostname(hostname string, zone string) string {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+
+	if hostname == "*" {
+		return hostname
+	}
+
+	if !strings.Contains(strings.TrimSuffix(hostname, "."), ".") {
+		hostname = strings.TrimSuffix(hostname, ".") + "." + zone
+	}
+
+	if !strings.HasSuffix(hostname, ".") {
+		hostname = hostname + "."
+	}
+
+	return hostname
+}
+
+func isBcrypt(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
@@ -0,0 +1,183 @@
+package auth_test
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/ratelimit"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testZone = "example.com."
+
+func TestParseUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hashed secret"), bcrypt.MinCost)
+
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	data := strings.Join([]string{
+		"# comment",
+		"",
+		"alice:secret:home,Office.example.com",
+		"bob:" + string(hash) + ":cabin.example.com.",
+		"carol:pass:word:*.example.com",
+		"  dave:secret:home:write=30/m,read=0  ",
+		"erin:a=b:home",
+	}, "\n")
+
+	store, err := auth.ParseUsers([]byte(data), testZone)
+
+	if err != nil {
+		t.Fatalf("ParseUsers: %v", err)
+	}
+
+	if store.Len() != 5 {
+		t.Fatalf("users = %d, want 5", store.Len())
+	}
+
+	tests := []struct {
+		name      string
+		password  string
+		hostnames []string
+	}{
+		{"alice", "secret", []string{"home.example.com.", "office.example.com."}},
+		{"bob", "hashed secret", []string{"cabin.example.com."}},
+		{"carol", "pass:word", []string{"*.example.com."}},
+		{"dave", "secret", []string{"home.example.com."}},
+		{"erin", "a=b", []string{"home.example.com."}},
+	}
+
+	for _, tt := range tests {
+		user, ok := store.Authenticate(tt.name, tt.password)
+
+		if !ok {
+			t.Fatalf("Authenticate(%s, %s) failed", tt.name, tt.password)
+		}
+
+		if !slices.Equal(user.Hostnames, tt.hostnames) {
+			t.Fatalf("%s hostnames = %v, want %v", tt.name, user.Hostnames, tt.hostnames)
+		}
+
+		if _, ok := store.Authenticate(tt.name, tt.password+"x"); ok {
+			t.Fatalf("Authenticate(%s) succeeded with a wrong password", tt.name)
+		}
+	}
+
+	if _, ok := store.Authenticate("bob", string(hash)); ok {
+		t.Fatal("Authenticate(bob) succeeded with the hash as password")
+	}
+
+	dave, _ := store.Authenticate("dave", "secret")
+
+	if dave.Limits.Write == nil || *dave.Limits.Write != (ratelimit.Limit{Count: 30, Period: time.Minute}) {
+		t.Fatalf("dave write limit = %v, want 30/m", dave.Limits.Write)
+	}
+
+	if dave.Limits.Read == nil || *dave.Limits.Read != (ratelimit.Limit{}) {
+		t.Fatalf("dave read limit = %v, want unlimited", dave.Limits.Read)
+	}
+
+	alice, _ := store.Authenticate("alice", "secret")
+
+	if alice.Limits.Read != nil || alice.Limits.Write != nil {
+		t.Fatalf("alice limits = %+v, want the defaults", alice.Limits)
+	}
+}
+
+func TestParseUsersInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "no password", data: "alice", want: "line 1: expected username:password:hostnames"},
+		{name: "no hostnames field", data: "# comment\nalice:secret", want: "line 2: expected username:password:hostnames"},
+		{name: "no username", data: ":secret:home", want: "line 1: expected username:password:hostnames"},
+		{name: "empty hostnames", data: "alice:secret: , ", want: `line 1: no hostnames for user "alice"`},
+		{name: "limits without hostnames", data: "alice:secret:write=30/m", want: "line 1: expected username:password:hostnames"},
+		{name: "bad limit", data: "alice:secret:home:write=often", want: "line 1:"},
+		{name: "duplicate user", data: "alice:secret:home\nalice:other:office", want: "line 2: duplicate user: alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.ParseUsers([]byte(tt.data), testZone)
+
+			if !errors.Is(err, auth.ErrInvalidUsersFile) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %v with %q", err, auth.ErrInvalidUsersFile, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDuplicate(t *testing.T) {
+	store := auth.NewStore()
+
+	if err := store.Add("alice", "secret", []string{"*"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	if err := store.AddUser(&auth.User{Name: "alice"}, "other"); !errors.Is(err, auth.ErrDuplicateUser) {
+		t.Fatalf("error = %v, want %v", err, auth.ErrDuplicateUser)
+	}
+}
+
+func TestMayUpdate(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		hostname string
+		want     bool
+	}{
+		{"home.example.com.", "home.example.com.", true},
+		{"home.example.com.", "HOME.Example.com.", true},
+		{"home.example.com.", "office.example.com.", false},
+		{"*.example.com.", "home.example.com.", true},
+		{"*.example.com.", "example.com.", false},
+		{"*.example.com.", "www.home.example.com.", false},
+		{"*.home.example.com.", "www.home.example.com.", true},
+		{"home-*.example.com.", "home-1.example.com.", true},
+		{"home-*.example.com.", "office-1.example.com.", false},
+		{"home?.example.com.", "home1.example.com.", true},
+		{"*", "www.home.example.org.", true},
+		{"[", "home.example.com.", false},
+	}
+
+	for _, tt := range tests {
+		user := &auth.User{Hostnames: []string{tt.pattern}}
+
+		if got := user.MayUpdate(tt.hostname); got != tt.want {
+			t.Fatalf("%s MayUpdate(%s) = %v, want %v", tt.pattern, tt.hostname, got, tt.want)
+		}
+	}
+
+	user := &auth.User{Hostnames: []string{"home.example.com.", "*.office.example.com."}}
+
+	if !user.MayUpdate("printer.office.example.com.") || user.MayUpdate("cabin.example.com.") {
+		t.Fatal("MayUpdate does not check every pattern of the user")
+	}
+}
+
+func TestQualifyHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"home", "home.example.com."},
+		{" Home ", "home.example.com."},
+		{"home.", "home.example.com."},
+		{"home.example.com", "home.example.com."},
+		{"*.example.com", "*.example.com."},
+		{"*", "*"},
+	}
+
+	for _, tt := range tests {
+		if got := auth.QualifyHostname(tt.hostname, testZone); got != tt.want {
+			t.Fatalf("QualifyHostname(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
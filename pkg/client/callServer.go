@@ -4,7 +4,7 @@ import (
 	"dyndns/pkg/server"
 	"errors"
 	"github.com/go-resty/resty/v2"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"strings"
@@ -19,6 +19,32 @@ type caller struct {
 
 func (c *caller) Call(host string, v4Address *net.IP, v6Address *net.IP, auth ...string) (*server.UpdateResult, error) {
 
+	var ipAddress string
+	var ipv6Address string
+
+	if v4Address != nil {
+		ipAddress = v4Address.String()
+	}
+
+	if v6Address != nil {
+		ipv6Address = v6Address.String()
+	}
+
+	return c.call(host, map[string]string{
+		"ip_address":   ipAddress,
+		"ipv6_address": ipv6Address,
+	}, auth...)
+}
+
+// CallDetect lets the server use the address the request arrives from instead of sending one.
+func (c *caller) CallDetect(host string, auth ...string) (*server.UpdateResult, error) {
+	return c.call(host, map[string]string{
+		"auto": "true",
+	}, auth...)
+}
+
+func (c *caller) call(host string, params map[string]string, auth ...string) (*server.UpdateResult, error) {
+
 	c.client.SetBaseURL(host)
 
 	if len(auth) > 0 && len(auth[0]) > 0 {
@@ -26,29 +52,16 @@ func (c *caller) Call(host string, v4Address *net.IP, v6Address *net.IP, auth ..
 		if len(credentials) == 2 {
 			c.client.SetBasicAuth(credentials[0], credentials[1])
 		} else {
-			log.Printf("[DynDNS Client] Could not parse credentials into username and password. Format should be username:password.")
+			slog.Warn("Could not parse credentials into username and password. Format should be username:password.")
 		}
 	}
 
 	var serverResponse server.UpdateResult
 
-	var ipAddress string
-	var ipv6Address string
-
-	if v4Address != nil {
-		ipAddress = v4Address.String()
-	}
-
-	if v6Address != nil {
-		ipv6Address = v6Address.String()
-	}
-
 	response, err := c.client.R().
 		SetResult(&serverResponse).
-		SetQueryParams(map[string]string{
-			"ip_address":   ipAddress,
-			"ipv6_address": ipv6Address,
-		}).Get("/dyn")
+		SetQueryParams(params).
+		Get("/dyn")
 
 	if err != nil {
 		return nil, err
@@ -39,4 +39,5 @@ type IpGrabber interface {
 
 type RemoteApiCaller interface {
 	Call(host string, v4Address *net.IP, v6Address *net.IP, auth ...string) (*server.UpdateResult, error)
+	CallDetect(host string, auth ...string) (*server.UpdateResult, error)
 }
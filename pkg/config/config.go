@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the YAML config file at path. Unknown keys are rejected so typos do not silently fall back to defaults.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*File, error) {
+	file := &File{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigFile, err)
+	}
+
+	return file, nil
+}
+
+// Flags returns the values set in the file keyed by the name of the flag they correspond to. Lists are joined with
+// commas the way the flags expect them.
+func (f *File) Flags() map[string]string {
+	flags := map[string]string{}
+
+	set := func(name string, value string) {
+		if value != "" {
+			flags[name] = value
+		}
+	}
+
+	set("bind-address", f.Listen.BindAddress)
+	set("metrics-address", f.Listen.MetricsAddress)
+	set("ip-source", f.Listen.IPSource)
+	set("trusted-proxies", strings.Join(f.Listen.TrustedProxies, ","))
+	set("proxy-protocol", f.Listen.ProxyProtocol)
+	set("shutdown-timeout", f.Listen.ShutdownTimeout)
+	set("auth", f.Auth.User)
+	set("users-file", f.Auth.UsersFile)
+	set("provider", f.Backend.Provider)
+	set("ready-check-interval", f.Backend.ReadyCheckInterval)
+	set("domain-name", f.DomainName)
+	set("zone", f.Zone)
+	set("hostnames", strings.Join(f.Hostnames, ","))
+	set("ttl", f.Policy.TTL)
+	set("min-ttl", f.Policy.MinTTL)
+	set("max-ttl", f.Policy.MaxTTL)
+	set("history-file", f.History.File)
+	set("history-retention", f.History.Retention)
+	set("rate-limit-read", f.RateLimit.Read)
+	set("rate-limit-write", f.RateLimit.Write)
+	set("log-format", f.Log.Format)
+	set("log-level", f.Log.Level)
+	set("log-sink", f.Log.Sink)
+
+	for name, value := range f.Backend.Options {
+		set(name, value)
+	}
+
+	return flags
+}
+
+// Apply sets the flags of fs from the file that were given neither on the command line nor through one of their
+// environment variables. envs lists the environment variables of each flag by flag name.
+func (f *File) Apply(fs *flag.FlagSet, envs map[string][]string) error {
+	setOnCommandLine := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) {
+		setOnCommandLine[fl.Name] = true
+	})
+
+	for name, value := range f.Flags() {
+		if setOnCommandLine[name] || envSet(envs[name]) {
+			continue
+		}
+
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfigFile, name, err)
+		}
+	}
+
+	return nil
+}
+
+func envSet(envs []string) bool {
+	for _, env := range envs {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
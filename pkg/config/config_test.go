@@ -0,0 +1,166 @@
+package config_test
+
+import (
+	"dyndns/pkg/config"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+listen:
+  bind-address: ":9000"
+  trusted-proxies: [10.0.0.0/8, 192.168.0.0/16]
+backend:
+  provider: memory
+  options:
+    memory-latency: 1s
+domain-name: home.example.com
+hostnames: [office, cabin]
+log:
+  level: debug
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte(testConfig), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	file, err := config.Load(path)
+
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := map[string]string{
+		"bind-address":    ":9000",
+		"trusted-proxies": "10.0.0.0/8,192.168.0.0/16",
+		"provider":        "memory",
+		"memory-latency":  "1s",
+		"domain-name":     "home.example.com",
+		"hostnames":       "office,cabin",
+		"log-level":       "debug",
+	}
+
+	flags := file.Flags()
+
+	if len(flags) != len(want) {
+		t.Fatalf("flags = %v, want %v", flags, want)
+	}
+
+	for name, value := range want {
+		if flags[name] != value {
+			t.Fatalf("flag %s = %q, want %q", name, flags[name], value)
+		}
+	}
+
+	if _, err := config.Load(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	file, err := config.Parse(nil)
+
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if flags := file.Flags(); len(flags) != 0 {
+		t.Fatalf("flags = %v, want none", flags)
+	}
+}
+
+func TestParseUnknownFields(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "top level", data: "domain_name: home.example.com", want: "field domain_name not found"},
+		{name: "nested", data: "listen:\n  bind: :8080", want: "field bind not found"},
+		{name: "flag name at top level", data: "bind-address: :8080", want: "field bind-address not found"},
+		{name: "wrong type", data: "hostnames: {home: true}", want: "cannot unmarshal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Parse([]byte(tt.data))
+
+			if !errors.Is(err, config.ErrInvalidConfigFile) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %v with %q", err, config.ErrInvalidConfigFile, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	file, err := config.Parse([]byte(testConfig))
+
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	t.Setenv("TEST_DYNDNS_DOMAIN", "env.example.com")
+	t.Setenv("TEST_DYNDNS_LOG_LEVEL", "")
+
+	fs := flag.NewFlagSet("dyndns", flag.ContinueOnError)
+	bindAddress := fs.String("bind-address", ":8080", "")
+	provider := fs.String("provider", "google", "")
+	domainName := fs.String("domain-name", "env.example.com", "")
+	hostnames := fs.String("hostnames", "", "")
+	logLevel := fs.String("log-level", "info", "")
+	latency := fs.String("memory-latency", "0s", "")
+	_ = fs.String("trusted-proxies", "", "")
+
+	if err := fs.Parse([]string{"--provider", "memory", "--bind-address", ":8081"}); err != nil {
+		t.Fatalf("Parse flags: %v", err)
+	}
+
+	envs := map[string][]string{
+		"domain-name": {"TEST_DYNDNS_DOMAIN"},
+		"log-level":   {"TEST_DYNDNS_LOG_LEVEL"},
+	}
+
+	if err := file.Apply(fs, envs); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"bind-address from the command line", *bindAddress, ":8081"},
+		{"provider from the command line", *provider, "memory"},
+		{"domain-name from the environment", *domainName, "env.example.com"},
+		{"log-level from the file, its variable is empty", *logLevel, "debug"},
+		{"hostnames from the file", *hostnames, "office,cabin"},
+		{"backend option from the file", *latency, "1s"},
+	}
+
+	for _, tt := range tests {
+		if tt.value != tt.want {
+			t.Fatalf("%s = %q, want %q", tt.name, tt.value, tt.want)
+		}
+	}
+}
+
+func TestApplyUnknownFlag(t *testing.T) {
+	file, err := config.Parse([]byte("backend:\n  options:\n    bogus-option: x"))
+
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	fs := flag.NewFlagSet("dyndns", flag.ContinueOnError)
+
+	if err := file.Apply(fs, nil); !errors.Is(err, config.ErrInvalidConfigFile) || !strings.Contains(err.Error(), "bogus-option") {
+		t.Fatalf("error = %v, want %v for bogus-option", err, config.ErrInvalidConfigFile)
+	}
+}
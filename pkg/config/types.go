@@ -0,0 +1,67 @@
+package config
+
+import "errors"
+
+var (
+	ErrInvalidConfigFile = errors.New("invalid config file")
+)
+
+// File is the layout of the YAML config file given with --config. Every value corresponds to a command line flag of
+// the same name and is only used if neither the flag nor its environment variable is set.
+type File struct {
+	Listen     Listen    `yaml:"listen"`
+	Auth       Auth      `yaml:"auth"`
+	Backend    Backend   `yaml:"backend"`
+	DomainName string    `yaml:"domain-name"`
+	Zone       string    `yaml:"zone"`
+	Hostnames  []string  `yaml:"hostnames"`
+	Policy     Policy    `yaml:"policy"`
+	History    History   `yaml:"history"`
+	RateLimit  RateLimit `yaml:"rate-limit"`
+	Log        Log       `yaml:"log"`
+}
+
+type Listen struct {
+	BindAddress     string   `yaml:"bind-address"`
+	MetricsAddress  string   `yaml:"metrics-address"`
+	IPSource        string   `yaml:"ip-source"`
+	TrustedProxies  []string `yaml:"trusted-proxies"`
+	ProxyProtocol   string   `yaml:"proxy-protocol"`
+	ShutdownTimeout string   `yaml:"shutdown-timeout"`
+}
+
+type Auth struct {
+	// User is a single username:password that may update every hostname, the same as --auth.
+	User      string `yaml:"user"`
+	UsersFile string `yaml:"users-file"`
+}
+
+type Backend struct {
+	Provider string `yaml:"provider"`
+	// Options holds the provider parameters by flag name, e.g. project-id or cloudflare-api-token.
+	Options map[string]string `yaml:"options"`
+	// ReadyCheckInterval is how long /readyz reuses its check of the backend.
+	ReadyCheckInterval string `yaml:"ready-check-interval"`
+}
+
+type Policy struct {
+	TTL    string `yaml:"ttl"`
+	MinTTL string `yaml:"min-ttl"`
+	MaxTTL string `yaml:"max-ttl"`
+}
+
+type History struct {
+	File      string `yaml:"file"`
+	Retention string `yaml:"retention"`
+}
+
+type RateLimit struct {
+	Read  string `yaml:"read"`
+	Write string `yaml:"write"`
+}
+
+type Log struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+	Sink   string `yaml:"sink"`
+}
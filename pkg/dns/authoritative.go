@@ -0,0 +1,621 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	miekg "github.com/miekg/dns"
+)
+
+var (
+	ErrAuthoritativeNotInZone = errors.New("record name is not inside the served zone")
+)
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "authoritative",
+		Description: "Built-in authoritative DNS server serving the records itself",
+		Options: []ProviderOption{
+			{Name: "authoritative-listen", Env: "DYNDNS_AUTHORITATIVE_LISTEN", Default: ":53", Usage: "UDP and TCP address of the DNS listener"},
+			{Name: "authoritative-zone", Env: "DYNDNS_AUTHORITATIVE_ZONE", Usage: "Zone served by the DNS listener, e.g. dyn.mydomain.tld", Required: true},
+			{Name: "authoritative-ns", Env: "DYNDNS_AUTHORITATIVE_NS", Usage: "Comma separated name servers of the zone (default ns1.<zone>)"},
+			{Name: "authoritative-ns-address", Env: "DYNDNS_AUTHORITATIVE_NS_ADDRESS", Usage: "Comma separated IPs served for name servers inside the zone (glue)"},
+			{Name: "authoritative-hostmaster", Env: "DYNDNS_AUTHORITATIVE_HOSTMASTER", Usage: "SOA mailbox of the zone (default hostmaster.<zone>)"},
+			{Name: "authoritative-ttl", Env: "DYNDNS_AUTHORITATIVE_TTL", Default: "60", Usage: "TTL of the served records"},
+			{Name: "authoritative-state-file", Env: "DYNDNS_AUTHORITATIVE_STATE_FILE", Usage: "File to persist the records and SOA serial across restarts"},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			ttl, err := strconv.ParseUint(cfg.Get("authoritative-ttl"), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid authoritative-ttl: %v", err)
+			}
+
+			var nsAddresses []net.IP
+			for _, address := range splitList(cfg.Get("authoritative-ns-address")) {
+				ip := net.ParseIP(address)
+				if ip == nil {
+					return nil, fmt.Errorf("[DynDNS Server] invalid authoritative-ns-address %q", address)
+				}
+				nsAddresses = append(nsAddresses, ip)
+			}
+
+			service, err := NewAuthoritativeService(&AuthoritativeConfig{
+				Listen:      cfg.Get("authoritative-listen"),
+				Zone:        cfg.Get("authoritative-zone"),
+				NameServers: splitList(cfg.Get("authoritative-ns")),
+				NSAddresses: nsAddresses,
+				Hostmaster:  cfg.Get("authoritative-hostmaster"),
+				TTL:         uint32(ttl),
+				StateFile:   cfg.Get("authoritative-state-file"),
+			}, cfg.DomainName)
+			if err != nil {
+				return nil, err
+			}
+
+			return service, nil
+		},
+		Stateful: true,
+	})
+}
+
+type AuthoritativeConfig struct {
+	Listen      string
+	Zone        string
+	NameServers []string
+	NSAddresses []net.IP
+	Hostmaster  string
+	TTL         uint32
+	StateFile   string
+}
+
+// AuthoritativeService answers DNS queries for its zone itself. Records accepted by UpdateDNSRecord are served
+// immediately and every change bumps the SOA serial, so secondaries notice it.
+type AuthoritativeService struct {
+	mu          sync.RWMutex
+	zone        string
+	nameServers []string
+	nsAddresses []net.IP
+	hostmaster  string
+	ttl         uint32
+	stateFile   string
+	domainName  string
+	state       authoritativeState
+	servers     []*miekg.Server
+	listen      string
+}
+
+type authoritativeState struct {
+	Serial  uint32                       `json:"serial"`
+	Records map[string]map[string]string `json:"records"`
+	// TTLs holds the TTL per name and type. Records without an entry use the zone TTL.
+	TTLs map[string]map[string]uint32 `json:"ttls,omitempty"`
+}
+
+// NewAuthoritativeService loads the persisted state and starts the UDP and TCP listeners.
+func NewAuthoritativeService(cfg *AuthoritativeConfig, domainName string) (*AuthoritativeService, error) {
+	zone := miekg.CanonicalName(cfg.Zone)
+
+	nameServers := cfg.NameServers
+	if len(nameServers) == 0 {
+		nameServers = []string{"ns1." + zone}
+	}
+	for i, ns := range nameServers {
+		nameServers[i] = miekg.CanonicalName(ns)
+	}
+
+	hostmaster := cfg.Hostmaster
+	if hostmaster == "" {
+		hostmaster = "hostmaster." + zone
+	}
+
+	s := &AuthoritativeService{
+		zone:        zone,
+		nameServers: nameServers,
+		nsAddresses: cfg.NSAddresses,
+		hostmaster:  miekg.CanonicalName(strings.Replace(hostmaster, "@", ".", 1)),
+		ttl:         cfg.TTL,
+		stateFile:   cfg.StateFile,
+		domainName:  miekg.CanonicalName(domainName),
+		listen:      cfg.Listen,
+		state: authoritativeState{
+			Serial:  uint32(time.Now().Unix()),
+			Records: map[string]map[string]string{},
+			TTLs:    map[string]map[string]uint32{},
+		},
+	}
+
+	if !miekg.IsSubDomain(s.zone, s.domainName) {
+		return nil, fmt.Errorf("[DynDNS Server] %s: %w (%s)", s.domainName, ErrAuthoritativeNotInZone, s.zone)
+	}
+
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *AuthoritativeService) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
+
+	if ipAddress == "" && ipv6Address == "" {
+		return nil, nil
+	}
+
+	var result, v6Result *UpdateResult
+
+	if ipAddress != "" {
+		result = s.updateRecord(hostname, "A", ipAddress, ttl)
+	}
+
+	if ipv6Address != "" {
+		v6Result = s.updateRecord(hostname, "AAAA", ipv6Address, ttl)
+	}
+
+	return result, v6Result
+}
+
+func (s *AuthoritativeService) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = s.removeRecord(hostname, "A")
+	}
+
+	if v6 {
+		v6Result = s.removeRecord(hostname, "AAAA")
+	}
+
+	return result, v6Result
+}
+
+// ValidateCredentials asks the own listener for the SOA of the zone, which proves it is up and serving.
+func (s *AuthoritativeService) ValidateCredentials() error {
+	return s.CheckHealth()
+}
+
+// CheckHealth queries the SOA of the zone from the own DNS listener.
+func (s *AuthoritativeService) CheckHealth() error {
+	query := new(miekg.Msg)
+	query.SetQuestion(s.zone, miekg.TypeSOA)
+
+	response, _, err := (&miekg.Client{Net: "udp", Timeout: 5 * time.Second}).Exchange(query, s.localAddress())
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to query own DNS listener: %v", err)
+	}
+
+	if response.Rcode != miekg.RcodeSuccess || len(response.Answer) == 0 {
+		return fmt.Errorf("[DynDNS Server] own DNS listener answered %s", miekg.RcodeToString[response.Rcode])
+	}
+
+	return nil
+}
+
+// Close stops the DNS listeners.
+func (s *AuthoritativeService) Close() error {
+	var errs []error
+	for _, server := range s.servers {
+		errs = append(errs, server.Shutdown())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *AuthoritativeService) updateRecord(name string, rrType string, value string, ttl int) *UpdateResult {
+	if ttl == 0 {
+		ttl = int(s.ttl)
+	}
+
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+		Value:  value,
+		TTL:    ttl,
+	}
+
+	name = miekg.CanonicalName(name)
+	if !miekg.IsSubDomain(s.zone, name) {
+		result.Error = fmt.Errorf("[DynDNS Server] %s: %w (%s)", name, ErrAuthoritativeNotInZone, s.zone)
+		return result
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, ok := s.state.Records[name]
+	if !ok {
+		records = map[string]string{}
+		s.state.Records[name] = records
+	}
+
+	ttls, ok := s.state.TTLs[name]
+	if !ok {
+		ttls = map[string]uint32{}
+		s.state.TTLs[name] = ttls
+	}
+
+	previous, exists := records[rrType]
+	result.PreviousValue = previous
+
+	if exists && previous == value && s.recordTTL(name, rrType) == uint32(ttl) {
+		result.Unchanged = true
+		result.Success = true
+		return result
+	}
+
+	snapshot := s.snapshot(name, rrType)
+
+	records[rrType] = value
+	ttls[rrType] = uint32(ttl)
+	s.bumpSerial()
+
+	if err := s.saveState(); err != nil {
+		s.restore(name, rrType, snapshot)
+		result.Error = fmt.Errorf("[DynDNS Server] failed to persist authoritative state: %v", err)
+		return result
+	}
+
+	if exists {
+		result.Updated = true
+	} else {
+		result.Created = true
+	}
+	result.Success = true
+
+	return result
+}
+
+func (s *AuthoritativeService) removeRecord(name string, rrType string) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+	}
+
+	name = miekg.CanonicalName(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.state.Records[name][rrType]
+	if !exists {
+		result.Success = true
+		return result
+	}
+
+	snapshot := s.snapshot(name, rrType)
+
+	delete(s.state.Records[name], rrType)
+	delete(s.state.TTLs[name], rrType)
+
+	if len(s.state.Records[name]) == 0 {
+		delete(s.state.Records, name)
+		delete(s.state.TTLs, name)
+	}
+
+	s.bumpSerial()
+
+	if err := s.saveState(); err != nil {
+		s.restore(name, rrType, snapshot)
+		result.Error = fmt.Errorf("[DynDNS Server] failed to persist authoritative state: %v", err)
+		return result
+	}
+
+	result.PreviousValue = previous
+	result.Deleted = true
+	result.Success = true
+
+	return result
+}
+
+// recordSnapshot is a record and the SOA serial as they were before a change, to undo a change that could not be
+// persisted.
+type recordSnapshot struct {
+	value  string
+	exists bool
+	ttl    uint32
+	hasTTL bool
+	serial uint32
+}
+
+// snapshot captures the record of name and type. Must be called with the lock held.
+func (s *AuthoritativeService) snapshot(name string, rrType string) recordSnapshot {
+	value, exists := s.state.Records[name][rrType]
+	ttl, hasTTL := s.state.TTLs[name][rrType]
+
+	return recordSnapshot{value: value, exists: exists, ttl: ttl, hasTTL: hasTTL, serial: s.state.Serial}
+}
+
+// restore puts back the record of name and type and the SOA serial captured by snapshot, so the listener never
+// serves a change the state file does not hold. Must be called with the lock held.
+func (s *AuthoritativeService) restore(name string, rrType string, snapshot recordSnapshot) {
+	if snapshot.exists {
+		if s.state.Records[name] == nil {
+			s.state.Records[name] = map[string]string{}
+		}
+		s.state.Records[name][rrType] = snapshot.value
+	} else {
+		delete(s.state.Records[name], rrType)
+	}
+
+	if snapshot.hasTTL {
+		if s.state.TTLs[name] == nil {
+			s.state.TTLs[name] = map[string]uint32{}
+		}
+		s.state.TTLs[name][rrType] = snapshot.ttl
+	} else {
+		delete(s.state.TTLs[name], rrType)
+	}
+
+	if len(s.state.Records[name]) == 0 {
+		delete(s.state.Records, name)
+	}
+	if len(s.state.TTLs[name]) == 0 {
+		delete(s.state.TTLs, name)
+	}
+
+	s.state.Serial = snapshot.serial
+}
+
+// bumpSerial increases the SOA serial, preferring the current unix time so serials stay monotonic across restarts
+// without a state file. Must be called with the lock held.
+func (s *AuthoritativeService) bumpSerial() {
+	now := uint32(time.Now().Unix())
+	if now > s.state.Serial {
+		s.state.Serial = now
+	} else {
+		s.state.Serial++
+	}
+}
+
+func (s *AuthoritativeService) start() error {
+	handler := miekg.NewServeMux()
+	handler.HandleFunc(s.zone, s.serveDNS)
+
+	packetConn, err := net.ListenPacket("udp", s.listen)
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to listen on udp %s: %v", s.listen, err)
+	}
+
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		_ = packetConn.Close()
+		return fmt.Errorf("[DynDNS Server] failed to listen on tcp %s: %v", s.listen, err)
+	}
+
+	s.servers = []*miekg.Server{
+		{PacketConn: packetConn, Handler: handler},
+		{Listener: listener, Handler: handler},
+	}
+
+	for _, server := range s.servers {
+		go func(server *miekg.Server) {
+			if err := server.ActivateAndServe(); err != nil {
+				slog.Error("DNS listener stopped", "provider", "authoritative", "error", err)
+			}
+		}(server)
+	}
+
+	slog.Info("Serving zone", "provider", "authoritative", "zone", s.zone, "listen", s.listen)
+
+	return nil
+}
+
+func (s *AuthoritativeService) serveDNS(w miekg.ResponseWriter, r *miekg.Msg) {
+	response := new(miekg.Msg)
+	response.SetReply(r)
+	response.Authoritative = true
+
+	if len(r.Question) != 1 {
+		response.SetRcode(r, miekg.RcodeFormatError)
+		_ = w.WriteMsg(response)
+		return
+	}
+
+	question := r.Question[0]
+	name := miekg.CanonicalName(question.Name)
+
+	if !miekg.IsSubDomain(s.zone, name) {
+		response.Authoritative = false
+		response.SetRcode(r, miekg.RcodeRefused)
+		_ = w.WriteMsg(response)
+		return
+	}
+
+	s.mu.RLock()
+	answers, exists := s.lookup(name, question.Qtype)
+	soa := s.soa()
+	s.mu.RUnlock()
+
+	response.Answer = answers
+
+	if !exists {
+		response.Rcode = miekg.RcodeNameError
+	}
+
+	if len(answers) == 0 {
+		response.Ns = []miekg.RR{soa}
+	}
+
+	_ = w.WriteMsg(response)
+}
+
+// lookup returns the records of name and qtype and whether the name exists at all. Must be called with the read
+// lock held.
+func (s *AuthoritativeService) lookup(name string, qtype uint16) ([]miekg.RR, bool) {
+	var answers []miekg.RR
+	exists := false
+
+	if name == s.zone {
+		exists = true
+		switch qtype {
+		case miekg.TypeSOA:
+			answers = append(answers, s.soa())
+		case miekg.TypeNS:
+			for _, ns := range s.nameServers {
+				answers = append(answers, &miekg.NS{Hdr: s.header(s.zone, miekg.TypeNS, s.ttl), Ns: ns})
+			}
+		}
+	}
+
+	for _, ns := range s.nameServers {
+		if ns != name {
+			continue
+		}
+		for _, ip := range s.nsAddresses {
+			if rr := s.addressRR(name, qtype, ip.String(), s.ttl); rr != nil {
+				answers = append(answers, rr)
+			}
+			exists = true
+		}
+	}
+
+	if records, ok := s.state.Records[name]; ok && len(records) > 0 {
+		exists = true
+		for rrType, value := range records {
+			if qtype != miekg.TypeANY && miekg.TypeToString[qtype] != rrType {
+				continue
+			}
+			if rr := s.addressRR(name, miekg.StringToType[rrType], value, s.recordTTL(name, rrType)); rr != nil {
+				answers = append(answers, rr)
+			}
+		}
+	}
+
+	if !exists {
+		// Names below an existing name exist as empty non-terminals.
+		for recordName := range s.state.Records {
+			if recordName != name && miekg.IsSubDomain(name, recordName) {
+				exists = true
+				break
+			}
+		}
+	}
+
+	return answers, exists
+}
+
+// recordTTL returns the TTL stored for the record. Must be called with the read lock held.
+func (s *AuthoritativeService) recordTTL(name string, rrType string) uint32 {
+	if ttl, ok := s.state.TTLs[name][rrType]; ok {
+		return ttl
+	}
+	return s.ttl
+}
+
+func (s *AuthoritativeService) addressRR(name string, qtype uint16, value string, ttl uint32) miekg.RR {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+
+	switch {
+	case qtype == miekg.TypeA && ip.To4() != nil:
+		return &miekg.A{Hdr: s.header(name, miekg.TypeA, ttl), A: ip.To4()}
+	case qtype == miekg.TypeAAAA && ip.To4() == nil:
+		return &miekg.AAAA{Hdr: s.header(name, miekg.TypeAAAA, ttl), AAAA: ip}
+	}
+
+	return nil
+}
+
+func (s *AuthoritativeService) soa() miekg.RR {
+	return &miekg.SOA{
+		Hdr:     s.header(s.zone, miekg.TypeSOA, s.ttl),
+		Ns:      s.nameServers[0],
+		Mbox:    s.hostmaster,
+		Serial:  s.state.Serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  604800,
+		Minttl:  s.ttl,
+	}
+}
+
+func (s *AuthoritativeService) header(name string, rrType uint16, ttl uint32) miekg.RR_Header {
+	return miekg.RR_Header{Name: name, Rrtype: rrType, Class: miekg.ClassINET, Ttl: ttl}
+}
+
+func (s *AuthoritativeService) localAddress() string {
+	host, port, err := net.SplitHostPort(s.listen)
+	if err != nil {
+		return s.listen
+	}
+
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+func (s *AuthoritativeService) loadState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to read authoritative state: %v", err)
+	}
+
+	var state authoritativeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to parse authoritative state: %v", err)
+	}
+
+	if state.Records != nil {
+		s.state.Records = state.Records
+	}
+	if state.TTLs != nil {
+		s.state.TTLs = state.TTLs
+	}
+	if state.Serial > s.state.Serial {
+		s.state.Serial = state.Serial
+	}
+
+	return nil
+}
+
+// saveState writes the state to a temporary file and renames it, so a crash never leaves a truncated file behind.
+// Must be called with the lock held.
+func (s *AuthoritativeService) saveState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(&s.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.stateFile)
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
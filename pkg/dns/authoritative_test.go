@@ -0,0 +1,93 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newAuthoritativeService(t *testing.T, stateFile string) *dns.AuthoritativeService {
+	t.Helper()
+
+	service, err := dns.NewAuthoritativeService(&dns.AuthoritativeConfig{
+		Listen:    "127.0.0.1:0",
+		Zone:      "example.com",
+		TTL:       60,
+		StateFile: stateFile,
+	}, testHostname)
+
+	if err != nil {
+		t.Fatalf("NewAuthoritativeService: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = service.Close()
+	})
+
+	return service
+}
+
+func TestAuthoritativePersistsState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	service := newAuthoritativeService(t, stateFile)
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if !result.Success || !result.Created {
+		t.Fatalf("A result = %+v, want created", result)
+	}
+
+	_ = service.Close()
+
+	restarted := newAuthoritativeService(t, stateFile)
+	result, _ = restarted.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if !result.Success || !result.Unchanged {
+		t.Fatalf("A result after restart = %+v, want unchanged", result)
+	}
+}
+
+func TestAuthoritativeRollsBackUnpersistedChange(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state", "state.json")
+
+	service := newAuthoritativeService(t, stateFile)
+
+	// The missing directory makes every save fail
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if result.Success || result.Created || result.Error == nil {
+		t.Fatalf("A result = %+v, want a persistence error", result)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "state"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if !result.Success || !result.Created || result.PreviousValue != "" {
+		t.Fatalf("A result = %+v, want created after the rolled back attempt", result)
+	}
+
+	if err := os.Remove(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "state")); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, _ := service.DeleteDNSRecord(testHostname, true, false)
+
+	if deleted.Success || deleted.Deleted || deleted.Error == nil {
+		t.Fatalf("A delete result = %+v, want a persistence error", deleted)
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if !result.Success || !result.Unchanged {
+		t.Fatalf("A result = %+v, want the record kept after the rolled back deletion", result)
+	}
+}
@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/dns/v1"
+)
+
+// recordCache keeps the record sets of a Cloud DNS zone in memory, so updates that change nothing need no API call.
+// Changes are built from the cached record sets; if another writer changed them in between, Cloud DNS rejects the
+// change and it is retried with a fresh read. An update the cache reports as a no-op is answered without the API
+// though, so a record changed outside the server can be reported unchanged until its entry is older than maxAge.
+type recordCache struct {
+	mu      sync.RWMutex
+	maxAge  time.Duration
+	loaded  time.Time
+	records map[string]map[string]*dns.ResourceRecordSet
+	// fetched holds when the record sets of a name were read or written after the last full load.
+	fetched map[string]time.Time
+}
+
+func newRecordCache(maxAge time.Duration) *recordCache {
+	return &recordCache{
+		maxAge:  maxAge,
+		records: map[string]map[string]*dns.ResourceRecordSet{},
+		fetched: map[string]time.Time{},
+	}
+}
+
+// lookup returns the cached record sets of name. ok is false until the cache has been loaded once and when the
+// entry of name is older than maxAge, e.g. because the periodic reload failed.
+func (c *recordCache) lookup(name string) (rrSets []*dns.ResourceRecordSet, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	name = strings.ToLower(name)
+
+	fetched, ok := c.fetched[name]
+	if !ok {
+		fetched = c.loaded
+	}
+
+	if fetched.IsZero() || time.Since(fetched) > c.maxAge {
+		return nil, false
+	}
+
+	for _, rrSet := range c.records[name] {
+		rrSets = append(rrSets, rrSet)
+	}
+
+	return rrSets, true
+}
+
+// store adds or replaces the given record sets.
+func (c *recordCache) store(rrSets ...*dns.ResourceRecordSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	putRecords(c.records, rrSets)
+}
+
+// remove drops the given record sets.
+func (c *recordCache) remove(rrSets ...*dns.ResourceRecordSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, rrSet := range rrSets {
+		delete(c.records[strings.ToLower(rrSet.Name)], rrSet.Type)
+	}
+}
+
+// storeName replaces all record sets of name with the given ones, read from the API at fetched.
+func (c *recordCache) storeName(name string, rrSets []*dns.ResourceRecordSet, fetched time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name = strings.ToLower(name)
+
+	delete(c.records, name)
+	putRecords(c.records, rrSets)
+	c.fetched[name] = fetched
+}
+
+// replace swaps the whole content of the cache after a full zone listing that started at loaded.
+func (c *recordCache) replace(rrSets []*dns.ResourceRecordSet, loaded time.Time) {
+	records := map[string]map[string]*dns.ResourceRecordSet{}
+	putRecords(records, rrSets)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.records = records
+	c.fetched = map[string]time.Time{}
+	c.loaded = loaded
+}
+
+func putRecords(records map[string]map[string]*dns.ResourceRecordSet, rrSets []*dns.ResourceRecordSet) {
+	for _, rrSet := range rrSets {
+		name := strings.ToLower(rrSet.Name)
+
+		if records[name] == nil {
+			records[name] = map[string]*dns.ResourceRecordSet{}
+		}
+
+		records[name][rrSet.Type] = rrSet
+	}
+}
@@ -0,0 +1,371 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	CloudflareDefaultEndpoint = "https://api.cloudflare.com/client/v4"
+	// CloudflareAutomaticTTL tells Cloudflare to choose the TTL itself. Proxied records always use it.
+	CloudflareAutomaticTTL = 1
+	CloudflareMinTTL       = 30
+	CloudflareMaxTTL       = 86400
+)
+
+var (
+	ErrCloudflareAPI = errors.New("cloudflare API error")
+)
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "cloudflare",
+		Description: "Cloudflare DNS",
+		Options: []ProviderOption{
+			{Name: "cloudflare-api-token", Env: "DYNDNS_CLOUDFLARE_API_TOKEN", Usage: "Cloudflare API token with DNS edit permission for the zone", Required: true, Secret: true},
+			{Name: "cloudflare-zone-id", Env: "DYNDNS_CLOUDFLARE_ZONE_ID", Usage: "Cloudflare zone ID", Required: true},
+			{Name: "cloudflare-proxied", Env: "DYNDNS_CLOUDFLARE_PROXIED", Default: "false", Usage: "Proxy the records through Cloudflare"},
+			{Name: "cloudflare-ttl", Env: "DYNDNS_CLOUDFLARE_TTL", Default: "1", Usage: "Record TTL in seconds, 1 means automatic"},
+			{Name: "cloudflare-endpoint", Env: "DYNDNS_CLOUDFLARE_ENDPOINT", Default: CloudflareDefaultEndpoint, Usage: "Cloudflare API endpoint"},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			proxied, err := strconv.ParseBool(cfg.Get("cloudflare-proxied"))
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid cloudflare-proxied: %v", err)
+			}
+
+			ttl, err := strconv.Atoi(cfg.Get("cloudflare-ttl"))
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid cloudflare-ttl: %v", err)
+			}
+
+			return NewCloudflareService(&CloudflareConfig{
+				Endpoint: cfg.Get("cloudflare-endpoint"),
+				APIToken: cfg.Get("cloudflare-api-token"),
+				ZoneID:   cfg.Get("cloudflare-zone-id"),
+				Proxied:  proxied,
+				TTL:      ttl,
+			}, cfg.DomainName)
+		},
+	})
+}
+
+type CloudflareConfig struct {
+	Endpoint string
+	APIToken string
+	ZoneID   string
+	Proxied  bool
+	TTL      int
+}
+
+type cloudflareService struct {
+	client     *resty.Client
+	zoneID     string
+	proxied    bool
+	ttl        int
+	domainName string
+}
+
+// CloudflareRecord is a DNS record as returned by the Cloudflare v4 API. Names carry no trailing dot.
+type CloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+type CloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type cloudflareResponse[T any] struct {
+	Success bool              `json:"success"`
+	Errors  []CloudflareError `json:"errors"`
+	Result  T                 `json:"result"`
+}
+
+func (r *cloudflareResponse[T]) err() error {
+	if r.Success {
+		return nil
+	}
+
+	var messages []string
+	for _, e := range r.Errors {
+		messages = append(messages, fmt.Sprintf("%d: %s", e.Code, e.Message))
+	}
+
+	return fmt.Errorf("%w: %s", ErrCloudflareAPI, strings.Join(messages, ", "))
+}
+
+func NewCloudflareService(cfg *CloudflareConfig, domainName string) (DynDNSService, error) {
+
+	if cfg.TTL != CloudflareAutomaticTTL && (cfg.TTL < CloudflareMinTTL || cfg.TTL > CloudflareMaxTTL) {
+		return nil, fmt.Errorf("[DynDNS Server] invalid cloudflare TTL %d: use 1 (automatic) or %d-%d", cfg.TTL, CloudflareMinTTL, CloudflareMaxTTL)
+	}
+
+	if cfg.Proxied && cfg.TTL != CloudflareAutomaticTTL {
+		return nil, errors.New("[DynDNS Server] proxied cloudflare records always use the automatic TTL (1)")
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = CloudflareDefaultEndpoint
+	}
+
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(cfg.Endpoint, "/"))
+	client.SetAuthToken(cfg.APIToken)
+	client.SetHeader("Content-Type", "application/json")
+	client.SetTimeout(30 * time.Second)
+	client.SetDisableWarn(true)
+
+	return &cloudflareService{
+		client:     client,
+		zoneID:     cfg.ZoneID,
+		proxied:    cfg.Proxied,
+		ttl:        cfg.TTL,
+		domainName: domainName,
+	}, nil
+}
+
+func (s *cloudflareService) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
+
+	if ipAddress == "" && ipv6Address == "" {
+		return nil, nil
+	}
+
+	var result, v6Result *UpdateResult
+
+	if ipAddress != "" {
+		result = s.updateRecord(hostname, "A", ipAddress, ttl)
+	}
+
+	if ipv6Address != "" {
+		v6Result = s.updateRecord(hostname, "AAAA", ipv6Address, ttl)
+	}
+
+	return result, v6Result
+}
+
+func (s *cloudflareService) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = s.removeRecord(hostname, "A")
+	}
+
+	if v6 {
+		v6Result = s.removeRecord(hostname, "AAAA")
+	}
+
+	return result, v6Result
+}
+
+func (s *cloudflareService) ValidateCredentials() error {
+
+	// Token Test
+	if err := s.CheckHealth(); err != nil {
+		return err
+	}
+
+	testName := fmt.Sprintf("%s.%d.%s", DNSCredentialValidationRecord, time.Now().Unix(), s.domainName)
+
+	// Write Test
+	record, err := s.createRecord(&CloudflareRecord{
+		Type:    "A",
+		Name:    cloudflareName(testName),
+		Content: DNSCredentialValidationIP,
+		TTL:     CloudflareAutomaticTTL,
+	})
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create DNS record: %v", err)
+	}
+
+	// Cleanup
+	if err := s.deleteRecord(record.ID); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to delete DNS record: %v", err)
+	}
+
+	return nil
+}
+
+func (s *cloudflareService) CheckHealth() error {
+	var verify cloudflareResponse[struct {
+		Status string `json:"status"`
+	}]
+	if err := s.do(s.client.R().SetResult(&verify).SetError(&verify), "GET", "/user/tokens/verify", &verify); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to verify API token: %v", err)
+	}
+
+	if verify.Result.Status != "active" {
+		return fmt.Errorf("[DynDNS Server] API token is %s", verify.Result.Status)
+	}
+
+	return nil
+}
+
+func (s *cloudflareService) updateRecord(name string, rrType string, value string, ttl int) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+		Value:  value,
+		TTL:    s.effectiveTTL(ttl),
+	}
+
+	record := &CloudflareRecord{
+		Type:    rrType,
+		Name:    cloudflareName(name),
+		Content: value,
+		TTL:     result.TTL,
+		Proxied: s.proxied,
+	}
+
+	existing, err := s.findRecord(record.Name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get DNS record: %v", err)
+		return result
+	}
+
+	if existing == nil {
+		if _, err := s.createRecord(record); err != nil {
+			result.Error = fmt.Errorf("[DynDNS Server] failed to create DNS record: %v", err)
+			return result
+		}
+
+		result.Created = true
+		result.Success = true
+		return result
+	}
+
+	result.PreviousValue = existing.Content
+
+	if existing.Content == record.Content && existing.TTL == record.TTL && existing.Proxied == record.Proxied {
+		result.Unchanged = true
+		result.Success = true
+		return result
+	}
+
+	var response cloudflareResponse[CloudflareRecord]
+	err = s.do(s.client.R().SetBody(record).SetResult(&response).SetError(&response), "PUT", "/zones/"+s.zoneID+"/dns_records/"+existing.ID, &response)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to update DNS record: %v", err)
+		return result
+	}
+
+	result.Updated = true
+	result.Success = true
+	return result
+}
+
+func (s *cloudflareService) removeRecord(name string, rrType string) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+	}
+
+	existing, err := s.findRecord(cloudflareName(name), rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get DNS record: %v", err)
+		return result
+	}
+
+	if existing == nil {
+		result.Success = true
+		return result
+	}
+
+	if err := s.deleteRecord(existing.ID); err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to delete DNS record: %v", err)
+		return result
+	}
+
+	result.PreviousValue = existing.Content
+	result.Deleted = true
+	result.Success = true
+	return result
+}
+
+func (s *cloudflareService) findRecord(name string, rrType string) (*CloudflareRecord, error) {
+	var response cloudflareResponse[[]CloudflareRecord]
+
+	err := s.do(s.client.R().
+		SetQueryParams(map[string]string{"type": rrType, "name": name}).
+		SetResult(&response).
+		SetError(&response), "GET", "/zones/"+s.zoneID+"/dns_records", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Result) == 0 {
+		return nil, nil
+	}
+
+	return &response.Result[0], nil
+}
+
+func (s *cloudflareService) createRecord(record *CloudflareRecord) (*CloudflareRecord, error) {
+	var response cloudflareResponse[CloudflareRecord]
+
+	err := s.do(s.client.R().SetBody(record).SetResult(&response).SetError(&response), "POST", "/zones/"+s.zoneID+"/dns_records", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.Result, nil
+}
+
+func (s *cloudflareService) deleteRecord(id string) error {
+	var response cloudflareResponse[struct {
+		ID string `json:"id"`
+	}]
+
+	return s.do(s.client.R().SetResult(&response).SetError(&response), "DELETE", "/zones/"+s.zoneID+"/dns_records/"+id, &response)
+}
+
+// do executes the request and turns transport errors, non 2xx answers and unsuccessful envelopes into errors.
+func (s *cloudflareService) do(request *resty.Request, method string, path string, envelope interface{ err() error }) error {
+	response, err := request.Execute(method, path)
+	if err != nil {
+		return err
+	}
+
+	if err := envelope.err(); err != nil {
+		return err
+	}
+
+	if !response.IsSuccess() {
+		return fmt.Errorf("%w: unexpected status %s", ErrCloudflareAPI, response.Status())
+	}
+
+	return nil
+}
+
+// effectiveTTL clamps the requested TTL to the range Cloudflare accepts. A TTL of 1 selects the automatic TTL like in
+// the Cloudflare API. Proxied records always use the automatic TTL.
+func (s *cloudflareService) effectiveTTL(ttl int) int {
+	switch {
+	case s.proxied:
+		return CloudflareAutomaticTTL
+	case ttl == 0:
+		return s.ttl
+	case ttl == CloudflareAutomaticTTL:
+		return CloudflareAutomaticTTL
+	case ttl < CloudflareMinTTL:
+		return CloudflareMinTTL
+	case ttl > CloudflareMaxTTL:
+		return CloudflareMaxTTL
+	}
+	return ttl
+}
+
+func cloudflareName(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
@@ -0,0 +1,213 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	"dyndns/pkg/dns/fakecloudflare"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	testCloudflareToken  = "token"
+	testCloudflareZoneID = "023e105f4ecef8ad9ca31a8372d0c353"
+	testCloudflareName   = "home.example.com"
+)
+
+func newCloudflareService(t *testing.T, cfg dns.CloudflareConfig) (dns.DynDNSService, *fakecloudflare.Server) {
+	t.Helper()
+
+	srv := fakecloudflare.NewServer(testCloudflareToken, testCloudflareZoneID, "example.com")
+	t.Cleanup(srv.Close)
+
+	cfg.Endpoint = srv.Endpoint()
+	cfg.ZoneID = testCloudflareZoneID
+
+	if cfg.APIToken == "" {
+		cfg.APIToken = testCloudflareToken
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = dns.CloudflareAutomaticTTL
+	}
+
+	service, err := dns.NewCloudflareService(&cfg, testHostname)
+
+	if err != nil {
+		t.Fatalf("NewCloudflareService: %v", err)
+	}
+
+	return service, srv
+}
+
+func assertCloudflareRecord(t *testing.T, srv *fakecloudflare.Server, rrType string, ttl int, content string) {
+	t.Helper()
+
+	record := srv.Record(testCloudflareName, rrType)
+
+	if record == nil {
+		t.Fatalf("%s record missing", rrType)
+	}
+
+	if record.TTL != ttl || record.Content != content {
+		t.Fatalf("%s record = ttl %d %s, want ttl %d %s", rrType, record.TTL, record.Content, ttl, content)
+	}
+}
+
+func TestCloudflareCreate(t *testing.T) {
+	service, srv := newCloudflareService(t, dns.CloudflareConfig{})
+
+	result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || !r.Created || r.Updated || r.PreviousValue != "" {
+			t.Fatalf("%s result = %+v, want created", r.RRType, r)
+		}
+	}
+
+	assertCloudflareRecord(t, srv, "A", dns.CloudflareAutomaticTTL, "192.0.2.1")
+	assertCloudflareRecord(t, srv, "AAAA", dns.CloudflareAutomaticTTL, "2001:db8::1")
+}
+
+func TestCloudflareUpdate(t *testing.T) {
+	service, srv := newCloudflareService(t, dns.CloudflareConfig{})
+	service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Updated || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want updated from 192.0.2.1", result)
+	}
+
+	assertCloudflareRecord(t, srv, "A", 300, "192.0.2.2")
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Unchanged || result.Updated {
+		t.Fatalf("A result = %+v, want unchanged", result)
+	}
+
+	if calls := srv.Calls(fakecloudflare.OperationUpdate); calls != 1 {
+		t.Fatalf("dns_records.update called %d times, want 1", calls)
+	}
+}
+
+func TestCloudflareTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultTTL int
+		proxied    bool
+		requested  int
+		want       int
+	}{
+		{name: "provider default", defaultTTL: 300, requested: 0, want: 300},
+		{name: "automatic", defaultTTL: 300, requested: dns.CloudflareAutomaticTTL, want: dns.CloudflareAutomaticTTL},
+		{name: "below minimum", requested: 2, want: dns.CloudflareMinTTL},
+		{name: "just below minimum", requested: dns.CloudflareMinTTL - 1, want: dns.CloudflareMinTTL},
+		{name: "above maximum", requested: 100000, want: dns.CloudflareMaxTTL},
+		{name: "in range", requested: 600, want: 600},
+		{name: "proxied", proxied: true, requested: 600, want: dns.CloudflareAutomaticTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, srv := newCloudflareService(t, dns.CloudflareConfig{TTL: tt.defaultTTL, Proxied: tt.proxied})
+
+			result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", tt.requested)
+
+			if !result.Success || result.TTL != tt.want {
+				t.Fatalf("A result = %+v, want ttl %d", result, tt.want)
+			}
+
+			assertCloudflareRecord(t, srv, "A", tt.want, "192.0.2.1")
+		})
+	}
+}
+
+func TestCloudflareAPIErrors(t *testing.T) {
+	tests := []struct {
+		op     fakecloudflare.Operation
+		status int
+	}{
+		{fakecloudflare.OperationListRecords, http.StatusInternalServerError},
+		{fakecloudflare.OperationCreate, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.op)+" "+http.StatusText(tt.status), func(t *testing.T) {
+			service, srv := newCloudflareService(t, dns.CloudflareConfig{})
+			srv.FailOperation(tt.op, tt.status)
+
+			result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+			if result.Success || result.Created || result.Error == nil || !strings.Contains(result.Error.Error(), dns.ErrCloudflareAPI.Error()) {
+				t.Fatalf("A result = %+v, want a Cloudflare API error", result)
+			}
+
+			if srv.Record(testCloudflareName, "A") != nil {
+				t.Fatal("A record created despite the failure")
+			}
+		})
+	}
+}
+
+func TestCloudflareInvalidToken(t *testing.T) {
+	service, _ := newCloudflareService(t, dns.CloudflareConfig{APIToken: "wrong"})
+
+	if err := service.CheckHealth(); err == nil {
+		t.Fatal("CheckHealth succeeded with an invalid token")
+	}
+
+	if err := service.ValidateCredentials(); err == nil {
+		t.Fatal("ValidateCredentials succeeded with an invalid token")
+	}
+}
+
+func TestCloudflareValidateCredentials(t *testing.T) {
+	service, srv := newCloudflareService(t, dns.CloudflareConfig{})
+
+	if err := service.ValidateCredentials(); err != nil {
+		t.Fatalf("ValidateCredentials: %v", err)
+	}
+
+	if srv.Calls(fakecloudflare.OperationCreate) != 1 || srv.Calls(fakecloudflare.OperationDelete) != 1 {
+		t.Fatal("ValidateCredentials did not create and delete a test record")
+	}
+}
+
+func TestCloudflareDelete(t *testing.T) {
+	service, srv := newCloudflareService(t, dns.CloudflareConfig{})
+	service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, false)
+
+	if v6Result != nil {
+		t.Fatalf("AAAA result = %+v, want nil", v6Result)
+	}
+
+	if !result.Success || !result.Deleted || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want deleted", result)
+	}
+
+	if srv.Record(testCloudflareName, "A") != nil {
+		t.Fatal("A record still exists")
+	}
+
+	assertCloudflareRecord(t, srv, "AAAA", dns.CloudflareAutomaticTTL, "2001:db8::1")
+}
+
+func TestCloudflareDeleteMissing(t *testing.T) {
+	service, srv := newCloudflareService(t, dns.CloudflareConfig{})
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, true)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || r.Deleted || r.Error != nil {
+			t.Fatalf("%s result = %+v, want success without deletion", r.RRType, r)
+		}
+	}
+
+	if calls := srv.Calls(fakecloudflare.OperationDelete); calls != 0 {
+		t.Fatalf("dns_records.delete called %d times, want 0", calls)
+	}
+}
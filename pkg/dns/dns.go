@@ -2,40 +2,132 @@ package dns
 
 import (
 	"context"
+	"dyndns/pkg/metrics"
 	"dyndns/pkg/utils"
+	"errors"
 	"fmt"
 	"google.golang.org/api/dns/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	DNSCredentialValidationRecord = "_dyndns_credential_validation_record"
 	DNSCredentialValidationIP     = "127.255.255.254"
+	GoogleDefaultTTL              = 60
+	// GoogleChangeAttempts limits how often a change is retried after a concurrent writer modified the records.
+	GoogleChangeAttempts = 3
 )
 
 var globalContext = context.Background()
 
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "google",
+		Description: "Google Cloud DNS",
+		Options: []ProviderOption{
+			{Name: "auth-file", Env: "DYNDNS_AUTH_FILE", Default: "google.json", Usage: "Path to file containing the Google Cloud credentials"},
+			{Name: "dns-zone-name", Env: "DYNDNS_DNS_ZONE_NAME", Usage: "DNS zone name", Required: true},
+			{Name: "project-id", Env: "DYNDNS_PROJECT_ID", Usage: "Google Cloud project ID", Required: true},
+			{Name: "google-endpoint", Env: "DYNDNS_GOOGLE_ENDPOINT", Usage: "Custom Cloud DNS API endpoint, e.g. a local stand-in. Requests are sent without credentials"},
+			{Name: "google-cache-refresh", Env: "DYNDNS_GOOGLE_CACHE_REFRESH", Default: "5m", Usage: "Interval in which the record cache is reloaded from Cloud DNS, 0 disables the cache. A record changed outside the server may be reported unchanged for up to this long"},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			refresh, err := time.ParseDuration(cfg.Get("google-cache-refresh"))
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid google-cache-refresh: %v", err)
+			}
+
+			if endpoint := cfg.Get("google-endpoint"); endpoint != "" {
+				return NewCachedService(refresh, "", cfg.Get("project-id"), cfg.Get("dns-zone-name"), cfg.DomainName, WithEndpoint(endpoint)...)
+			}
+			return NewCachedService(refresh, cfg.Get("auth-file"), cfg.Get("project-id"), cfg.Get("dns-zone-name"), cfg.DomainName)
+		},
+		CredentialFiles: func(cfg *ProviderConfig) []string {
+			if cfg.Get("google-endpoint") != "" {
+				return nil
+			}
+
+			path, err := utils.FindCredentialsPath(cfg.Get("auth-file"))
+			if err != nil {
+				return nil
+			}
+			return []string{path}
+		},
+	})
+}
+
 type service struct {
 	client      *dns.Service
 	authFile    string
 	projectID   string
 	dnsZoneName string
 	domainName  string
+	// cache is nil if caching is disabled
+	cache    *recordCache
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// WithEndpoint returns the client options to talk to a Cloud DNS compatible API at endpoint without credentials.
+func WithEndpoint(endpoint string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(endpoint),
+		option.WithoutAuthentication(),
+	}
 }
 
-func NewService(authFile, projectID, dnsZoneName, domainName string) (DynDNSService, error) {
+// NewService creates the Google Cloud DNS backend. The credentials are loaded from authFile unless it is empty and
+// custom client options, e.g. from WithEndpoint, are given.
+func NewService(authFile, projectID, dnsZoneName, domainName string, opts ...option.ClientOption) (DynDNSService, error) {
+	s, err := newService(authFile, projectID, dnsZoneName, domainName, opts...)
 
-	credentials, err := utils.FindCredentials(authFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewCachedService is NewService with a record cache that is loaded at startup and reloaded every refresh interval.
+// Cached record sets older than refresh are read from the API again. A refresh of 0 disables the cache. Close stops
+// the reloading.
+func NewCachedService(refresh time.Duration, authFile, projectID, dnsZoneName, domainName string, opts ...option.ClientOption) (DynDNSService, error) {
+	s, err := newService(authFile, projectID, dnsZoneName, domainName, opts...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	dnsClient, err := dns.NewService(globalContext,
+	if refresh > 0 {
+		s.startCache(refresh)
+	}
+
+	return s, nil
+}
+
+func newService(authFile, projectID, dnsZoneName, domainName string, opts ...option.ClientOption) (*service, error) {
+
+	clientOptions := []option.ClientOption{
 		option.WithScopes(dns.NdevClouddnsReadwriteScope),
-		option.WithCredentialsJSON(credentials),
-	)
+	}
+
+	if authFile != "" || len(opts) == 0 {
+		credentials, err := utils.FindCredentials(authFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		clientOptions = append(clientOptions, option.WithCredentialsJSON(credentials))
+	}
+
+	dnsClient, err := dns.NewService(globalContext, append(clientOptions, opts...)...)
 
 	if err != nil {
 		return nil, err
@@ -50,156 +142,358 @@ func NewService(authFile, projectID, dnsZoneName, domainName string) (DynDNSServ
 	}, nil
 }
 
-func (s *service) UpdateDNSRecord(ipAddress string, ipv6Address string) (*UpdateResult, *UpdateResult) {
+// UpdateDNSRecord writes the requested A and AAAA records with a single change, so either both families are updated
+// or none. Record sets that already hold the requested value and TTL are left alone. The change deletes the record
+// sets exactly as they were read from the cache or the API; Cloud DNS rejects it if another writer changed them in
+// between, and the update is retried with a fresh read.
+func (s *service) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
 
 	if ipAddress == "" && ipv6Address == "" {
 		return nil, nil
 	}
 
-	result := &UpdateResult{
-		Name:    s.domainName,
-		RRType:  "A",
-		Success: false,
-		Created: false,
-		Updated: false,
-		Value:   ipAddress,
-		Error:   nil,
+	if ttl == 0 {
+		ttl = GoogleDefaultTTL
 	}
 
-	v6Result := &UpdateResult{
-		Name:    s.domainName,
-		RRType:  "AAAA",
-		Success: false,
-		Created: false,
-		Updated: false,
-		Value:   ipv6Address,
-		Error:   nil,
-	}
+	var result, v6Result *UpdateResult
 
 	if ipAddress != "" {
-		if !s.recordExists(s.domainName, "A") {
-			rrSet, err := s.client.ResourceRecordSets.Create(s.projectID, s.dnsZoneName, &dns.ResourceRecordSet{
-				Kind:    "dns#resourceRecordSet",
-				Name:    s.domainName,
-				Type:    "A",
-				Ttl:     1,
-				Rrdatas: []string{ipAddress},
-			}).Do()
+		result = &UpdateResult{
+			Name:   hostname,
+			RRType: "A",
+			Value:  ipAddress,
+			TTL:    ttl,
+		}
+	}
 
-			if err != nil {
-				result.Error = fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
-			}
+	if ipv6Address != "" {
+		v6Result = &UpdateResult{
+			Name:   hostname,
+			RRType: "AAAA",
+			Value:  ipv6Address,
+			TTL:    ttl,
+		}
+	}
 
-			if rrSet.Rrdatas[0] != ipAddress {
-				result.Error = fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
-			}
+	var err error
 
-			if err == nil && rrSet.Rrdatas[0] == ipAddress {
-				result.Created = true
-				result.Success = true
-			}
-		} else {
-			rrSet, err := s.client.ResourceRecordSets.Patch(s.projectID, s.dnsZoneName, s.domainName, "A", &dns.ResourceRecordSet{
-				Kind:    "dns#resourceRecordSet",
-				Name:    s.domainName,
-				Type:    "A",
-				Ttl:     1,
-				Rrdatas: []string{ipAddress},
-			}).Do()
+	for attempt := 1; attempt <= GoogleChangeAttempts; attempt++ {
+		err = s.applyChange(hostname, ttl, attempt == 1, result, v6Result)
 
-			if err != nil {
-				result.Error = fmt.Errorf("[DynDNS Server] failed to patch resource record set: %v", err)
-			}
+		if !isConflict(err) {
+			break
+		}
+	}
 
-			if rrSet.Rrdatas[0] != ipAddress {
-				result.Error = fmt.Errorf("[DynDNS Server] failed to update resource record set: %v", err)
-			}
+	for _, r := range []*UpdateResult{result, v6Result} {
+		if r == nil {
+			continue
+		}
 
-			if err == nil && rrSet.Rrdatas[0] == ipAddress {
-				result.Updated = true
-				result.Success = true
-			}
+		if err != nil {
+			r.Created = false
+			r.Updated = false
+			r.Unchanged = false
+			r.ChangeID = ""
+			r.Error = err
+			continue
 		}
-	} else {
-		result = nil
+
+		r.Success = true
 	}
 
-	if ipv6Address != "" {
-		if !s.recordExists(s.domainName, "AAAA") {
-			rrSet, err := s.client.ResourceRecordSets.Create(s.projectID, s.dnsZoneName, &dns.ResourceRecordSet{
-				Kind:    "dns#resourceRecordSet",
-				Name:    s.domainName,
-				Type:    "AAAA",
-				Ttl:     1,
-				Rrdatas: []string{ipv6Address},
-			}).Do()
+	return result, v6Result
+}
 
-			if err != nil {
-				v6Result.Error = fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
-			}
+// applyChange reads the current record sets of hostname, from the cache if useCache is set, and replaces the
+// requested ones with one Changes.Create.
+func (s *service) applyChange(hostname string, ttl int, useCache bool, results ...*UpdateResult) error {
+	current, err := s.currentRecords(hostname, useCache)
 
-			if rrSet.Rrdatas[0] != ipv6Address {
-				v6Result.Error = fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
-			}
+	if err != nil {
+		return err
+	}
 
-			if err == nil && rrSet.Rrdatas[0] == ipv6Address {
-				v6Result.Created = true
-				v6Result.Success = true
-			}
-		} else {
-			rrSet, err := s.client.ResourceRecordSets.Patch(s.projectID, s.dnsZoneName, s.domainName, "AAAA", &dns.ResourceRecordSet{
-				Kind:    "dns#resourceRecordSet",
-				Name:    s.domainName,
-				Type:    "AAAA",
-				Ttl:     1,
-				Rrdatas: []string{ipv6Address},
-			}).Do()
+	change := &dns.Change{
+		Kind: "dns#change",
+	}
 
-			if err != nil {
-				v6Result.Error = fmt.Errorf("[DynDNS Server] failed to patch resource record set: %v", err)
-			}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+
+		existing := s.filterRecords(current, result.RRType)
+
+		result.Created = len(existing) == 0
+		result.Updated = len(existing) > 0
+		result.Unchanged = false
+		result.PreviousValue = ""
+
+		if len(existing) > 0 {
+			result.PreviousValue = strings.Join(existing[0].Rrdatas, ",")
 
-			if rrSet.Rrdatas[0] != ipv6Address {
-				v6Result.Error = fmt.Errorf("[DynDNS Server] failed to update resource record set: %v", err)
+			if existing[0].Ttl == int64(ttl) && result.PreviousValue == result.Value {
+				result.Updated = false
+				result.Unchanged = true
+				continue
 			}
+		}
+
+		change.Deletions = append(change.Deletions, existing...)
+		change.Additions = append(change.Additions, &dns.ResourceRecordSet{
+			Kind:    "dns#resourceRecordSet",
+			Name:    hostname,
+			Type:    result.RRType,
+			Ttl:     int64(ttl),
+			Rrdatas: []string{result.Value},
+		})
+	}
+
+	if len(change.Additions) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	applied, err := s.client.Changes.Create(s.projectID, s.dnsZoneName, change).Do()
+	metrics.ObserveAPICall("google", "changes.create", start, err)
+
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create change: %w", err)
+	}
+
+	for _, result := range results {
+		if result != nil && !result.Unchanged {
+			result.ChangeID = applied.Id
+		}
+	}
+
+	if s.cache != nil {
+		s.cache.store(change.Additions...)
+	}
+
+	return nil
+}
+
+// applyDeletion reads the current record sets of hostname and deletes the requested ones with one Changes.Create.
+func (s *service) applyDeletion(hostname string, useCache bool, results ...*UpdateResult) error {
+	current, err := s.currentRecords(hostname, useCache)
+
+	if err != nil {
+		return err
+	}
 
-			if err == nil && rrSet.Rrdatas[0] == ipv6Address {
-				v6Result.Updated = true
-				v6Result.Success = true
+	change := &dns.Change{
+		Kind: "dns#change",
+	}
+
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+
+		existing := s.filterRecords(current, result.RRType)
+
+		result.Deleted = len(existing) > 0
+		result.PreviousValue = ""
+
+		if len(existing) > 0 {
+			result.PreviousValue = strings.Join(existing[0].Rrdatas, ",")
+		}
+
+		change.Deletions = append(change.Deletions, existing...)
+	}
+
+	if len(change.Deletions) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	applied, err := s.client.Changes.Create(s.projectID, s.dnsZoneName, change).Do()
+	metrics.ObserveAPICall("google", "changes.create", start, err)
+
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create change: %w", err)
+	}
+
+	for _, result := range results {
+		if result != nil && result.Deleted {
+			result.ChangeID = applied.Id
+		}
+	}
+
+	if s.cache != nil {
+		s.cache.remove(change.Deletions...)
+	}
+
+	return nil
+}
+
+func (s *service) currentRecords(hostname string, useCache bool) ([]*dns.ResourceRecordSet, error) {
+	if useCache && s.cache != nil {
+		if rrSets, ok := s.cache.lookup(hostname); ok {
+			return rrSets, nil
+		}
+	}
+
+	start := time.Now()
+	current, err := s.client.ResourceRecordSets.List(s.projectID, s.dnsZoneName).Name(hostname).Do()
+	metrics.ObserveAPICall("google", "rrsets.list", start, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("[DynDNS Server] failed to list resource record sets: %w", err)
+	}
+
+	if s.cache != nil {
+		s.cache.storeName(hostname, current.Rrsets, start)
+	}
+
+	return current.Rrsets, nil
+}
+
+// Close stops the periodic reload of the record cache. It is safe to call more than once and concurrently.
+func (s *service) Close() error {
+	s.stopOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+	return nil
+}
+
+func (s *service) startCache(refresh time.Duration) {
+	s.cache = newRecordCache(refresh)
+	s.stop = make(chan struct{})
+
+	if err := s.loadCache(); err != nil {
+		slog.Warn("Failed to load record cache, reading from the API until the next refresh", "provider", "google", "error", err)
+	}
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.loadCache(); err != nil {
+					slog.Warn("Failed to refresh record cache", "provider", "google", "error", err)
+				}
+			case <-stop:
+				return
 			}
 		}
-	} else {
-		v6Result = nil
+	}(s.stop)
+}
+
+// loadCache lists all record sets of the zone page by page and replaces the cache content.
+func (s *service) loadCache() error {
+	var rrSets []*dns.ResourceRecordSet
+
+	start := time.Now()
+	err := s.client.ResourceRecordSets.List(s.projectID, s.dnsZoneName).Pages(globalContext, func(page *dns.ResourceRecordSetsListResponse) error {
+		rrSets = append(rrSets, page.Rrsets...)
+		return nil
+	})
+	metrics.ObserveAPICall("google", "rrsets.list_all", start, err)
+
+	if err != nil {
+		return err
+	}
+
+	s.cache.replace(rrSets, start)
+
+	return nil
+}
+
+// DeleteDNSRecord removes the requested record sets with a single change, retried like UpdateDNSRecord if another
+// writer changed them in between.
+func (s *service) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = &UpdateResult{
+			Name:   hostname,
+			RRType: "A",
+		}
+	}
+
+	if v6 {
+		v6Result = &UpdateResult{
+			Name:   hostname,
+			RRType: "AAAA",
+		}
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= GoogleChangeAttempts; attempt++ {
+		err = s.applyDeletion(hostname, attempt == 1, result, v6Result)
+
+		if !isConflict(err) {
+			break
+		}
+	}
+
+	for _, r := range []*UpdateResult{result, v6Result} {
+		if r == nil {
+			continue
+		}
+
+		if err != nil {
+			r.Deleted = false
+			r.ChangeID = ""
+			r.Error = err
+			continue
+		}
+
+		r.Success = true
 	}
 
 	return result, v6Result
 }
 
-func (s *service) ValidateCredentials() error {
-
-	// Read Test
+func (s *service) CheckHealth() error {
+	start := time.Now()
 	_, err := s.client.ManagedZones.Get(s.projectID, s.dnsZoneName).Do()
+	metrics.ObserveAPICall("google", "managedzones.get", start, err)
 	if err != nil {
 		return fmt.Errorf("[DynDNS Server] failed to get managed zone: %v", err)
 	}
 
+	return nil
+}
+
+func (s *service) ValidateCredentials() error {
+
+	// Read Test
+	if err := s.CheckHealth(); err != nil {
+		return err
+	}
+
 	var testName = fmt.Sprintf("%s.%d.%s", DNSCredentialValidationRecord, time.Now().Unix(), s.domainName)
 
 	// Write Test
-	_, err = s.client.ResourceRecordSets.Create(s.projectID, s.dnsZoneName, &dns.ResourceRecordSet{
+	start := time.Now()
+	_, err := s.client.ResourceRecordSets.Create(s.projectID, s.dnsZoneName, &dns.ResourceRecordSet{
 		Kind:    "dns#resourceRecordSet",
 		Name:    testName,
 		Type:    "A",
 		Ttl:     300,
 		Rrdatas: []string{DNSCredentialValidationIP},
 	}).Do()
+	metrics.ObserveAPICall("google", "rrsets.create", start, err)
 
 	if err != nil {
 		return fmt.Errorf("[DynDNS Server] failed to patch resource record set: %v", err)
 	}
 
 	// Cleanup
+	start = time.Now()
 	_, err = s.client.ResourceRecordSets.Delete(s.projectID, s.dnsZoneName, testName, "A").Do()
+	metrics.ObserveAPICall("google", "rrsets.delete", start, err)
 
 	if err != nil {
 		return fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
@@ -208,11 +502,6 @@ func (s *service) ValidateCredentials() error {
 	return nil
 }
 
-func (s *service) recordExists(name string, rrType string) bool {
-	_, err := s.client.ResourceRecordSets.Get(s.projectID, s.dnsZoneName, name, rrType).Do()
-	return err == nil
-}
-
 func (s *service) filterRecords(records []*dns.ResourceRecordSet, rrType string) []*dns.ResourceRecordSet {
 	var filteredRecords []*dns.ResourceRecordSet
 	for _, record := range records {
@@ -222,3 +511,12 @@ func (s *service) filterRecords(records []*dns.ResourceRecordSet, rrType string)
 	}
 	return filteredRecords
 }
+
+// isConflict reports whether Cloud DNS rejected a change because the record sets changed since they were read.
+func isConflict(err error) bool {
+	var apiError *googleapi.Error
+	if !errors.As(err, &apiError) {
+		return false
+	}
+	return apiError.Code == http.StatusPreconditionFailed || apiError.Code == http.StatusConflict
+}
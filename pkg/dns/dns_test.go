@@ -0,0 +1,337 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	"dyndns/pkg/dns/fakeclouddns"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	testProject  = "my-project"
+	testZone     = "my-zone"
+	testHostname = "home.example.com."
+)
+
+func newGoogleService(t *testing.T) (dns.DynDNSService, *fakeclouddns.Server) {
+	t.Helper()
+
+	srv := fakeclouddns.NewServer(testProject, testZone, "example.com.")
+	t.Cleanup(srv.Close)
+
+	service, err := dns.NewService("", testProject, testZone, testHostname, srv.ClientOptions()...)
+
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	return service, srv
+}
+
+func assertRecord(t *testing.T, srv *fakeclouddns.Server, rrType string, ttl int64, value string) {
+	t.Helper()
+
+	record := srv.Record(testHostname, rrType)
+
+	if record == nil {
+		t.Fatalf("%s record missing", rrType)
+	}
+
+	if record.Ttl != ttl || len(record.Rrdatas) != 1 || record.Rrdatas[0] != value {
+		t.Fatalf("%s record = ttl %d %v, want ttl %d [%s]", rrType, record.Ttl, record.Rrdatas, ttl, value)
+	}
+}
+
+func assertAPIError(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var apiErr *googleapi.Error
+
+	if !errors.As(err, &apiErr) || apiErr.Code != code {
+		t.Fatalf("error = %v, want API error %d", err, code)
+	}
+}
+
+func TestGoogleCreate(t *testing.T) {
+	service, srv := newGoogleService(t)
+
+	result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || !r.Created || r.Updated || r.Unchanged || r.PreviousValue != "" || r.ChangeID == "" {
+			t.Fatalf("%s result = %+v, want created", r.RRType, r)
+		}
+	}
+
+	if calls := srv.Calls(fakeclouddns.OperationChangesCreate); calls != 1 {
+		t.Fatalf("changes.create called %d times, want both families in 1 change", calls)
+	}
+
+	assertRecord(t, srv, "A", dns.GoogleDefaultTTL, "192.0.2.1")
+	assertRecord(t, srv, "AAAA", dns.GoogleDefaultTTL, "2001:db8::1")
+}
+
+func TestGooglePatch(t *testing.T) {
+	service, srv := newGoogleService(t)
+	srv.SetRecord(testHostname, "A", 300, "192.0.2.1")
+	srv.SetRecord(testHostname, "AAAA", 300, "2001:db8::1")
+
+	result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 120)
+
+	if v6Result != nil {
+		t.Fatalf("AAAA result = %+v, want nil", v6Result)
+	}
+
+	if !result.Success || !result.Updated || result.Created || result.PreviousValue != "192.0.2.1" || result.TTL != 120 {
+		t.Fatalf("A result = %+v, want updated from 192.0.2.1", result)
+	}
+
+	assertRecord(t, srv, "A", 120, "192.0.2.2")
+	assertRecord(t, srv, "AAAA", 300, "2001:db8::1")
+}
+
+func TestGoogleAPIErrors(t *testing.T) {
+	tests := []struct {
+		op     fakeclouddns.Operation
+		status int
+	}{
+		{fakeclouddns.OperationRRSetsList, http.StatusInternalServerError},
+		{fakeclouddns.OperationRRSetsList, http.StatusForbidden},
+		{fakeclouddns.OperationChangesCreate, http.StatusServiceUnavailable},
+		{fakeclouddns.OperationChangesCreate, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.op)+" "+http.StatusText(tt.status), func(t *testing.T) {
+			service, srv := newGoogleService(t)
+			srv.SetRecord(testHostname, "A", 60, "192.0.2.9")
+			srv.FailOperation(tt.op, tt.status)
+
+			result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+			for _, r := range []*dns.UpdateResult{result, v6Result} {
+				if r.Success || r.Created || r.Updated || r.ChangeID != "" {
+					t.Fatalf("%s result = %+v, want failure", r.RRType, r)
+				}
+
+				assertAPIError(t, r.Error, tt.status)
+			}
+
+			if calls := srv.Calls(tt.op); calls != 1 {
+				t.Fatalf("%s called %d times, want no retry", tt.op, calls)
+			}
+
+			assertRecord(t, srv, "A", 60, "192.0.2.9")
+
+			if srv.Record(testHostname, "AAAA") != nil {
+				t.Fatal("AAAA record created despite the failed change")
+			}
+		})
+	}
+}
+
+func newCachedGoogleService(t *testing.T, srv *fakeclouddns.Server) dns.DynDNSService {
+	t.Helper()
+
+	service, err := dns.NewCachedService(time.Hour, "", testProject, testZone, testHostname, srv.ClientOptions()...)
+
+	if err != nil {
+		t.Fatalf("NewCachedService: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = service.(io.Closer).Close()
+	})
+
+	return service
+}
+
+func TestGoogleConflictRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(srv *fakeclouddns.Server)
+		// previous is the value written by the other writer after the cache was loaded
+		previous string
+	}{
+		{
+			// The cache does not know the record, the addition collides with it
+			name:     "409 record created by another writer",
+			setup:    func(srv *fakeclouddns.Server) {},
+			previous: "192.0.2.9",
+		},
+		{
+			// The cache holds an outdated record, its deletion does not match
+			name: "412 record changed by another writer",
+			setup: func(srv *fakeclouddns.Server) {
+				srv.SetRecord(testHostname, "A", 60, "192.0.2.8")
+			},
+			previous: "192.0.2.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeclouddns.NewServer(testProject, testZone, "example.com.")
+			t.Cleanup(srv.Close)
+			tt.setup(srv)
+
+			service := newCachedGoogleService(t, srv)
+			srv.SetRecord(testHostname, "A", 60, tt.previous)
+
+			result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 60)
+
+			if !result.Success || !result.Updated || result.PreviousValue != tt.previous {
+				t.Fatalf("A result = %+v, want updated from %s", result, tt.previous)
+			}
+
+			if calls := srv.Calls(fakeclouddns.OperationChangesCreate); calls != 2 {
+				t.Fatalf("changes.create called %d times, want 2", calls)
+			}
+
+			assertRecord(t, srv, "A", 60, "192.0.2.1")
+		})
+	}
+}
+
+func TestGoogleConflictAttemptsExhausted(t *testing.T) {
+	for _, status := range []int{http.StatusConflict, http.StatusPreconditionFailed} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			service, srv := newGoogleService(t)
+			srv.FailOperation(fakeclouddns.OperationChangesCreate, status)
+
+			result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+			if result.Success || result.Created {
+				t.Fatalf("A result = %+v, want failure", result)
+			}
+
+			assertAPIError(t, result.Error, status)
+
+			if calls := srv.Calls(fakeclouddns.OperationChangesCreate); calls != dns.GoogleChangeAttempts {
+				t.Fatalf("changes.create called %d times, want %d", calls, dns.GoogleChangeAttempts)
+			}
+		})
+	}
+}
+
+func TestGoogleUnchanged(t *testing.T) {
+	service, srv := newGoogleService(t)
+	srv.SetRecord(testHostname, "A", 120, "192.0.2.1")
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 120)
+
+	if !result.Success || !result.Unchanged || result.Created || result.Updated {
+		t.Fatalf("A result = %+v, want unchanged", result)
+	}
+
+	if calls := srv.Calls(fakeclouddns.OperationChangesCreate); calls != 0 {
+		t.Fatalf("changes.create called %d times, want 0", calls)
+	}
+}
+
+func TestGoogleCachePagedList(t *testing.T) {
+	srv := fakeclouddns.NewServer(testProject, testZone, "example.com.")
+	t.Cleanup(srv.Close)
+	srv.SetPageSize(2)
+
+	hostnames := []string{"a.example.com.", "b.example.com.", "c.example.com.", "d.example.com.", "e.example.com."}
+
+	for _, hostname := range hostnames {
+		srv.SetRecord(hostname, "A", 60, "192.0.2.1")
+	}
+
+	service := newCachedGoogleService(t, srv)
+
+	if calls := srv.Calls(fakeclouddns.OperationRRSetsList); calls != 3 {
+		t.Fatalf("resourceRecordSets.list called %d times, want 3 pages", calls)
+	}
+
+	for _, hostname := range hostnames {
+		result, _ := service.UpdateDNSRecord(hostname, "192.0.2.1", "", 60)
+
+		if !result.Success || !result.Unchanged {
+			t.Fatalf("%s result = %+v, want unchanged from the cache", hostname, result)
+		}
+	}
+
+	if calls := srv.Calls(fakeclouddns.OperationRRSetsList); calls != 3 {
+		t.Fatalf("resourceRecordSets.list called %d times after the updates, want the cache to answer", calls)
+	}
+
+	if calls := srv.Calls(fakeclouddns.OperationChangesCreate); calls != 0 {
+		t.Fatalf("changes.create called %d times, want 0", calls)
+	}
+}
+
+func TestGoogleDelete(t *testing.T) {
+	service, srv := newGoogleService(t)
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+	srv.SetRecord(testHostname, "AAAA", 60, "2001:db8::1")
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, false)
+
+	if v6Result != nil {
+		t.Fatalf("AAAA result = %+v, want nil", v6Result)
+	}
+
+	if !result.Success || !result.Deleted || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want deleted", result)
+	}
+
+	if srv.Record(testHostname, "A") != nil {
+		t.Fatal("A record still exists")
+	}
+
+	assertRecord(t, srv, "AAAA", 60, "2001:db8::1")
+}
+
+func TestGoogleDeleteMissing(t *testing.T) {
+	service, srv := newGoogleService(t)
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, true)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || r.Deleted || r.Error != nil {
+			t.Fatalf("%s result = %+v, want success without deletion", r.RRType, r)
+		}
+	}
+
+	if calls := srv.Calls(fakeclouddns.OperationChangesCreate); calls != 0 {
+		t.Fatalf("changes.create called %d times, want 0", calls)
+	}
+}
+
+func TestGoogleCacheExpires(t *testing.T) {
+	srv := fakeclouddns.NewServer(testProject, testZone, "example.com.")
+	t.Cleanup(srv.Close)
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+
+	refresh := 100 * time.Millisecond
+
+	service, err := dns.NewCachedService(refresh, "", testProject, testZone, testHostname, srv.ClientOptions()...)
+
+	if err != nil {
+		t.Fatalf("NewCachedService: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = service.(io.Closer).Close()
+	})
+
+	// Without reloads the entry ages until it must be read from the API, which fails as well
+	srv.FailOperation(fakeclouddns.OperationRRSetsList, http.StatusInternalServerError)
+	time.Sleep(2 * refresh)
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 60)
+
+	if result.Success || result.Unchanged {
+		t.Fatalf("A result = %+v, want the expired entry read from the API", result)
+	}
+
+	assertAPIError(t, result.Error, http.StatusInternalServerError)
+}
@@ -0,0 +1,425 @@
+// Package fakeclouddns serves the subset of the Cloud DNS v1 REST API used by the dyndns server from a local
+// httptest server, so the Google code path can be exercised without network access or a Google project.
+package fakeclouddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/dns/v1"
+	"google.golang.org/api/option"
+)
+
+type Operation string
+
+const (
+	OperationManagedZonesGet Operation = "managedZones.get"
+	OperationRRSetsList      Operation = "resourceRecordSets.list"
+	OperationRRSetsGet       Operation = "resourceRecordSets.get"
+	OperationRRSetsCreate    Operation = "resourceRecordSets.create"
+	OperationRRSetsPatch     Operation = "resourceRecordSets.patch"
+	OperationRRSetsDelete    Operation = "resourceRecordSets.delete"
+	OperationChangesCreate   Operation = "changes.create"
+	OperationChangesGet      Operation = "changes.get"
+)
+
+// Server is an in-process stand-in for the Cloud DNS API serving a single managed zone.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	project  string
+	zone     *dns.ManagedZone
+	records  map[string]*dns.ResourceRecordSet
+	changes  map[string]*dns.Change
+	failures map[Operation]int
+	calls    map[Operation]int
+	pageSize int
+}
+
+// NewServer starts a fake Cloud DNS API for the managed zone zoneName (e.g. "my-zone") with the DNS name
+// dnsName (e.g. "example.com.") inside project. Close the server when done.
+func NewServer(project string, zoneName string, dnsName string) *Server {
+	s := &Server{
+		project: project,
+		zone: &dns.ManagedZone{
+			Kind:        "dns#managedZone",
+			Name:        zoneName,
+			DnsName:     dnsName,
+			Id:          1,
+			NameServers: []string{"ns-cloud-a1.googledomains.com."},
+			Visibility:  "public",
+		},
+		records:  map[string]*dns.ResourceRecordSet{},
+		changes:  map[string]*dns.Change{},
+		failures: map[Operation]int{},
+		calls:    map[Operation]int{},
+		pageSize: 100,
+	}
+
+	prefix := "/dns/v1/projects/{project}/managedZones/{zone}"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+prefix, s.handle(OperationManagedZonesGet, s.getManagedZone))
+	mux.HandleFunc("GET "+prefix+"/rrsets", s.handle(OperationRRSetsList, s.listRRSets))
+	mux.HandleFunc("POST "+prefix+"/rrsets", s.handle(OperationRRSetsCreate, s.createRRSet))
+	mux.HandleFunc("GET "+prefix+"/rrsets/{name}/{type}", s.handle(OperationRRSetsGet, s.getRRSet))
+	mux.HandleFunc("PATCH "+prefix+"/rrsets/{name}/{type}", s.handle(OperationRRSetsPatch, s.patchRRSet))
+	mux.HandleFunc("DELETE "+prefix+"/rrsets/{name}/{type}", s.handle(OperationRRSetsDelete, s.deleteRRSet))
+	mux.HandleFunc("POST "+prefix+"/changes", s.handle(OperationChangesCreate, s.createChange))
+	mux.HandleFunc("GET "+prefix+"/changes/{change}", s.handle(OperationChangesGet, s.getChange))
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// ClientOptions returns the options pointing a Cloud DNS client at this server.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.Endpoint()),
+		option.WithoutAuthentication(),
+	}
+}
+
+// Endpoint is the base path to use as custom Cloud DNS endpoint.
+func (s *Server) Endpoint() string {
+	return s.URL + "/"
+}
+
+// FailOperation makes every following call of op answer with the given HTTP status until ClearFailures is called.
+func (s *Server) FailOperation(op Operation, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[op] = status
+}
+
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = map[Operation]int{}
+}
+
+// Calls returns how often op was requested.
+func (s *Server) Calls(op Operation) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// SetPageSize sets the maximum number of record sets returned per list page.
+func (s *Server) SetPageSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = size
+}
+
+// SetRecord stores a record set directly, bypassing the API.
+func (s *Server) SetRecord(name string, rrType string, ttl int64, rrdatas ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[recordKey(name, rrType)] = &dns.ResourceRecordSet{
+		Kind:    "dns#resourceRecordSet",
+		Name:    name,
+		Type:    rrType,
+		Ttl:     ttl,
+		Rrdatas: rrdatas,
+	}
+}
+
+// Record returns a copy of the stored record set or nil.
+func (s *Server) Record(name string, rrType string) *dns.ResourceRecordSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rrSet, ok := s.records[recordKey(name, rrType)]
+	if !ok {
+		return nil
+	}
+	return copyRRSet(rrSet)
+}
+
+func (s *Server) handle(op Operation, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[op]++
+		status := s.failures[op]
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, fmt.Sprintf("injected failure for %s", op))
+			return
+		}
+
+		if r.PathValue("project") != s.project || r.PathValue("zone") != s.zone.Name {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("The 'parameters.managedZone' resource named '%s' does not exist.", r.PathValue("zone")))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) getManagedZone(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.zone)
+}
+
+func (s *Server) listRRSets(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.URL.Query().Get("name")
+	rrType := r.URL.Query().Get("type")
+
+	pageSize := s.pageSize
+	if maxResults, err := strconv.Atoi(r.URL.Query().Get("maxResults")); err == nil && maxResults > 0 && maxResults < pageSize {
+		pageSize = maxResults
+	}
+
+	var keys []string
+	for key, rrSet := range s.records {
+		if name != "" && !strings.EqualFold(rrSet.Name, name) {
+			continue
+		}
+		if rrType != "" && rrSet.Type != rrType {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	offset := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		parsed, err := strconv.Atoi(token)
+		if err != nil || parsed < 0 || parsed > len(keys) {
+			writeError(w, http.StatusBadRequest, "Invalid value for 'pageToken'")
+			return
+		}
+		offset = parsed
+	}
+
+	response := &dns.ResourceRecordSetsListResponse{
+		Kind: "dns#resourceRecordSetsListResponse",
+	}
+
+	end := offset + pageSize
+	if end < len(keys) {
+		response.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+
+	for _, key := range keys[offset:end] {
+		response.Rrsets = append(response.Rrsets, copyRRSet(s.records[key]))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getRRSet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rrSet, ok := s.records[recordKey(r.PathValue("name"), r.PathValue("type"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The 'parameters.name' resource named '%s' does not exist.", r.PathValue("name")))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rrSet)
+}
+
+func (s *Server) createRRSet(w http.ResponseWriter, r *http.Request) {
+	var rrSet dns.ResourceRecordSet
+	if err := json.NewDecoder(r.Body).Decode(&rrSet); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.validate(&rrSet); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key := recordKey(rrSet.Name, rrSet.Type)
+	if _, exists := s.records[key]; exists {
+		writeError(w, http.StatusConflict, fmt.Sprintf("The resource 'entity.rrset' named '%s (%s)' already exists", rrSet.Name, rrSet.Type))
+		return
+	}
+
+	rrSet.Kind = "dns#resourceRecordSet"
+	s.records[key] = &rrSet
+
+	writeJSON(w, http.StatusOK, &rrSet)
+}
+
+func (s *Server) patchRRSet(w http.ResponseWriter, r *http.Request) {
+	var patch dns.ResourceRecordSet
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := recordKey(r.PathValue("name"), r.PathValue("type"))
+	rrSet, ok := s.records[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The 'parameters.name' resource named '%s' does not exist.", r.PathValue("name")))
+		return
+	}
+
+	updated := copyRRSet(rrSet)
+	if patch.Ttl != 0 {
+		updated.Ttl = patch.Ttl
+	}
+	if len(patch.Rrdatas) > 0 {
+		updated.Rrdatas = patch.Rrdatas
+	}
+
+	if err := s.validate(updated); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.records[key] = updated
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteRRSet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := recordKey(r.PathValue("name"), r.PathValue("type"))
+	if _, ok := s.records[key]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The 'parameters.name' resource named '%s' does not exist.", r.PathValue("name")))
+		return
+	}
+
+	delete(s.records, key)
+
+	writeJSON(w, http.StatusOK, &dns.ResourceRecordSetsDeleteResponse{})
+}
+
+// createChange applies all deletions and additions of a change atomically, mirroring the Cloud DNS semantics:
+// deletions must match the current record set exactly and additions must not collide with a remaining record set.
+func (s *Server) createChange(w http.ResponseWriter, r *http.Request) {
+	var change dns.Change
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := map[string]*dns.ResourceRecordSet{}
+	for key, rrSet := range s.records {
+		records[key] = rrSet
+	}
+
+	for _, deletion := range change.Deletions {
+		key := recordKey(deletion.Name, deletion.Type)
+		current, ok := records[key]
+		if !ok || current.Ttl != deletion.Ttl || strings.Join(current.Rrdatas, ",") != strings.Join(deletion.Rrdatas, ",") {
+			writeError(w, http.StatusPreconditionFailed, fmt.Sprintf("The resource 'entity.change.deletions[%s]' named '%s (%s)' does not exist or does not match.", deletion.Name, deletion.Name, deletion.Type))
+			return
+		}
+		delete(records, key)
+	}
+
+	for _, addition := range change.Additions {
+		if err := s.validate(addition); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		key := recordKey(addition.Name, addition.Type)
+		if _, exists := records[key]; exists {
+			writeError(w, http.StatusConflict, fmt.Sprintf("The resource 'entity.change.additions[%s]' named '%s (%s)' already exists", addition.Name, addition.Name, addition.Type))
+			return
+		}
+		addition.Kind = "dns#resourceRecordSet"
+		records[key] = addition
+	}
+
+	s.records = records
+
+	change.Kind = "dns#change"
+	change.Id = strconv.Itoa(len(s.changes) + 1)
+	change.Status = "done"
+	change.StartTime = time.Now().UTC().Format(time.RFC3339)
+	s.changes[change.Id] = &change
+
+	writeJSON(w, http.StatusOK, &change)
+}
+
+func (s *Server) getChange(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change, ok := s.changes[r.PathValue("change")]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The 'parameters.changeId' resource named '%s' does not exist.", r.PathValue("change")))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, change)
+}
+
+func (s *Server) validate(rrSet *dns.ResourceRecordSet) error {
+	if rrSet.Name == "" || rrSet.Type == "" {
+		return fmt.Errorf("invalid value for 'entity.rrset': name and type are required")
+	}
+
+	if !strings.HasSuffix(strings.ToLower(rrSet.Name), strings.ToLower(s.zone.DnsName)) {
+		return fmt.Errorf("invalid value for 'entity.rrset.name': '%s' is not inside zone '%s'", rrSet.Name, s.zone.DnsName)
+	}
+
+	if len(rrSet.Rrdatas) == 0 {
+		return fmt.Errorf("invalid value for 'entity.rrset.rrdatas': at least one value is required")
+	}
+
+	return nil
+}
+
+func recordKey(name string, rrType string) string {
+	return strings.ToLower(name) + "/" + rrType
+}
+
+func copyRRSet(rrSet *dns.ResourceRecordSet) *dns.ResourceRecordSet {
+	c := *rrSet
+	c.Rrdatas = append([]string(nil), rrSet.Rrdatas...)
+	return &c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"errors": []map[string]string{
+				{"domain": "global", "reason": http.StatusText(status), "message": message},
+			},
+		},
+	})
+}
@@ -0,0 +1,274 @@
+// Package fakecloudflare serves the subset of the Cloudflare v4 API used by the dyndns server from a local
+// httptest server, so the Cloudflare backend can be exercised without network access or a Cloudflare account.
+package fakecloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"dyndns/pkg/dns"
+)
+
+type Operation string
+
+const (
+	OperationVerifyToken Operation = "tokens.verify"
+	OperationListRecords Operation = "dns_records.list"
+	OperationCreate      Operation = "dns_records.create"
+	OperationUpdate      Operation = "dns_records.update"
+	OperationDelete      Operation = "dns_records.delete"
+)
+
+// Server is an in-process stand-in for the Cloudflare v4 API serving a single zone.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	token    string
+	zoneID   string
+	zoneName string
+	nextID   int
+	records  map[string]*dns.CloudflareRecord
+	failures map[Operation]int
+	calls    map[Operation]int
+}
+
+// NewServer starts a fake Cloudflare API for the zone zoneName (e.g. "example.com") with the ID zoneID that only
+// accepts requests authenticated with token. Close the server when done.
+func NewServer(token string, zoneID string, zoneName string) *Server {
+	s := &Server{
+		token:    token,
+		zoneID:   zoneID,
+		zoneName: strings.TrimSuffix(zoneName, "."),
+		records:  map[string]*dns.CloudflareRecord{},
+		failures: map[Operation]int{},
+		calls:    map[Operation]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /user/tokens/verify", s.handle(OperationVerifyToken, s.verifyToken))
+	mux.HandleFunc("GET /zones/{zone}/dns_records", s.handle(OperationListRecords, s.listRecords))
+	mux.HandleFunc("POST /zones/{zone}/dns_records", s.handle(OperationCreate, s.createRecord))
+	mux.HandleFunc("PUT /zones/{zone}/dns_records/{id}", s.handle(OperationUpdate, s.updateRecord))
+	mux.HandleFunc("DELETE /zones/{zone}/dns_records/{id}", s.handle(OperationDelete, s.deleteRecord))
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Endpoint is the base URL to use as cloudflare-endpoint.
+func (s *Server) Endpoint() string {
+	return s.URL
+}
+
+// FailOperation makes every following call of op answer with the given HTTP status until ClearFailures is called.
+func (s *Server) FailOperation(op Operation, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[op] = status
+}
+
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = map[Operation]int{}
+}
+
+// Calls returns how often op was requested.
+func (s *Server) Calls(op Operation) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// Record returns a copy of the record with the given name (without trailing dot) and type or nil.
+func (s *Server) Record(name string, rrType string) *dns.CloudflareRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range s.records {
+		if strings.EqualFold(record.Name, name) && record.Type == rrType {
+			c := *record
+			return &c
+		}
+	}
+	return nil
+}
+
+func (s *Server) handle(op Operation, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[op]++
+		status := s.failures[op]
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, 1000+status, fmt.Sprintf("injected failure for %s", op))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+s.token {
+			writeError(w, http.StatusForbidden, 9109, "Invalid access token")
+			return
+		}
+
+		if zone := r.PathValue("zone"); op != OperationVerifyToken && zone != s.zoneID {
+			writeError(w, http.StatusNotFound, 7003, "Could not route to /zones/"+zone+", perhaps your object identifier is invalid?")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) verifyToken(w http.ResponseWriter, _ *http.Request) {
+	writeResult(w, http.StatusOK, map[string]string{"id": "token", "status": "active"})
+}
+
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.URL.Query().Get("name")
+	rrType := r.URL.Query().Get("type")
+
+	result := []dns.CloudflareRecord{}
+	for _, record := range s.records {
+		if name != "" && !strings.EqualFold(record.Name, name) {
+			continue
+		}
+		if rrType != "" && record.Type != rrType {
+			continue
+		}
+		result = append(result, *record)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	writeResult(w, http.StatusOK, result)
+}
+
+func (s *Server) createRecord(w http.ResponseWriter, r *http.Request) {
+	var record dns.CloudflareRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		writeError(w, http.StatusBadRequest, 9207, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if code, err := s.validate(&record); err != nil {
+		writeError(w, http.StatusBadRequest, code, err.Error())
+		return
+	}
+
+	for _, existing := range s.records {
+		if strings.EqualFold(existing.Name, record.Name) && existing.Type == record.Type && existing.Content == record.Content {
+			writeError(w, http.StatusBadRequest, 81058, "An identical record already exists.")
+			return
+		}
+	}
+
+	s.nextID++
+	record.ID = fmt.Sprintf("%032s", strconv.Itoa(s.nextID))
+	s.records[record.ID] = &record
+
+	writeResult(w, http.StatusOK, &record)
+}
+
+func (s *Server) updateRecord(w http.ResponseWriter, r *http.Request) {
+	var record dns.CloudflareRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		writeError(w, http.StatusBadRequest, 9207, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.records[id]; !ok {
+		writeError(w, http.StatusNotFound, 81044, "Record does not exist.")
+		return
+	}
+
+	if code, err := s.validate(&record); err != nil {
+		writeError(w, http.StatusBadRequest, code, err.Error())
+		return
+	}
+
+	record.ID = id
+	s.records[id] = &record
+
+	writeResult(w, http.StatusOK, &record)
+}
+
+func (s *Server) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.records[id]; !ok {
+		writeError(w, http.StatusNotFound, 81044, "Record does not exist.")
+		return
+	}
+
+	delete(s.records, id)
+
+	writeResult(w, http.StatusOK, map[string]string{"id": id})
+}
+
+// validate applies the checks Cloudflare does on records relevant to the server, including its TTL semantics.
+func (s *Server) validate(record *dns.CloudflareRecord) (int, error) {
+	if record.Name != s.zoneName && !strings.HasSuffix(record.Name, "."+s.zoneName) {
+		return 9007, fmt.Errorf("Content for %s record is invalid. Must be inside the zone %s", record.Type, s.zoneName)
+	}
+
+	if record.Type != "A" && record.Type != "AAAA" {
+		return 9004, fmt.Errorf("Unsupported record type %s", record.Type)
+	}
+
+	if record.TTL != dns.CloudflareAutomaticTTL && (record.TTL < dns.CloudflareMinTTL || record.TTL > dns.CloudflareMaxTTL) {
+		return 9021, fmt.Errorf("Invalid TTL. Must be between %d and %d seconds, or 1 for automatic.", dns.CloudflareMinTTL, dns.CloudflareMaxTTL)
+	}
+
+	if record.Proxied {
+		record.TTL = dns.CloudflareAutomaticTTL
+	}
+
+	return 0, nil
+}
+
+func writeResult(w http.ResponseWriter, status int, result interface{}) {
+	writeJSON(w, status, map[string]interface{}{
+		"success":  true,
+		"errors":   []interface{}{},
+		"messages": []interface{}{},
+		"result":   result,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"success":  false,
+		"errors":   []map[string]interface{}{{"code": code, "message": message}},
+		"messages": []interface{}{},
+		"result":   nil,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
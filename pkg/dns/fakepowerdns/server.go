@@ -0,0 +1,272 @@
+// Package fakepowerdns serves the subset of the PowerDNS Authoritative HTTP API used by the dyndns server from a
+// local httptest server, so the powerdns backend can be exercised without a PowerDNS installation.
+package fakepowerdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Operation string
+
+const (
+	OperationGetZone   Operation = "zones.get"
+	OperationPatchZone Operation = "zones.patch"
+)
+
+// Record is a single record of an RRset.
+type Record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+// RRSet is a resource record set as the API returns it, the name with trailing dot.
+type RRSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Records []Record `json:"records"`
+}
+
+// Server is an in-process stand-in for the PowerDNS API serving a single zone of the server "localhost".
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	apiKey       string
+	zoneName     string
+	rrSets       map[string]*RRSet
+	ignoreFilter bool
+	failures     map[Operation]int
+	calls        map[Operation]int
+}
+
+// NewServer starts a fake PowerDNS API for the zone zoneName (e.g. "example.com.") that only accepts requests with
+// the X-API-Key apiKey. Close the server when done.
+func NewServer(apiKey string, zoneName string) *Server {
+	s := &Server{
+		apiKey:   apiKey,
+		zoneName: fqdn(zoneName),
+		rrSets:   map[string]*RRSet{},
+		failures: map[Operation]int{},
+		calls:    map[Operation]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/servers/{server}/zones/{zone}", s.handle(OperationGetZone, s.getZone))
+	mux.HandleFunc("PATCH /api/v1/servers/{server}/zones/{zone}", s.handle(OperationPatchZone, s.patchZone))
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Endpoint is the base URL to use as powerdns-url.
+func (s *Server) Endpoint() string {
+	return s.URL
+}
+
+// IgnoreRRSetFilter makes the server return every RRset of the zone regardless of rrset_name and rrset_type, like
+// older PowerDNS versions do.
+func (s *Server) IgnoreRRSetFilter() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignoreFilter = true
+}
+
+// FailOperation makes every following call of op answer with the given HTTP status until ClearFailures is called.
+func (s *Server) FailOperation(op Operation, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[op] = status
+}
+
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = map[Operation]int{}
+}
+
+// Calls returns how often op was requested.
+func (s *Server) Calls(op Operation) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// SetRecord stores an RRset, replacing an existing one of the same name and type.
+func (s *Server) SetRecord(name string, rrType string, ttl int, contents ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rrSet := &RRSet{Name: fqdn(name), Type: rrType, TTL: ttl, Records: []Record{}}
+	for _, content := range contents {
+		rrSet.Records = append(rrSet.Records, Record{Content: content})
+	}
+
+	s.rrSets[rrSetKey(name, rrType)] = rrSet
+}
+
+// Record returns a copy of the RRset with the given name and type or nil.
+func (s *Server) Record(name string, rrType string) *RRSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rrSet, ok := s.rrSets[rrSetKey(name, rrType)]
+	if !ok {
+		return nil
+	}
+
+	c := *rrSet
+	c.Records = append([]Record(nil), rrSet.Records...)
+	return &c
+}
+
+func (s *Server) handle(op Operation, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[op]++
+		status := s.failures[op]
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, fmt.Sprintf("injected failure for %s", op))
+			return
+		}
+
+		if r.Header.Get("X-API-Key") != s.apiKey {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if server := r.PathValue("server"); server != "localhost" {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+
+		if zone := r.PathValue("zone"); !strings.EqualFold(zone, s.zoneName) {
+			writeError(w, http.StatusNotFound, "Could not find domain '"+zone+"'")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// getZone returns the zone with its RRsets sorted by name and type. rrsets=false leaves them out, rrset_name and
+// rrset_type select a single RRset unless the filter is ignored.
+func (s *Server) getZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	name, rrType := query.Get("rrset_name"), query.Get("rrset_type")
+
+	rrSets := []RRSet{}
+
+	if query.Get("rrsets") != "false" {
+		for _, rrSet := range s.rrSets {
+			if !s.ignoreFilter && name != "" && (!strings.EqualFold(rrSet.Name, name) || rrSet.Type != rrType) {
+				continue
+			}
+
+			rrSets = append(rrSets, *rrSet)
+		}
+	}
+
+	sort.Slice(rrSets, func(i, j int) bool {
+		return rrSetKey(rrSets[i].Name, rrSets[i].Type) < rrSetKey(rrSets[j].Name, rrSets[j].Type)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":     s.zoneName,
+		"name":   s.zoneName,
+		"kind":   "Native",
+		"rrsets": rrSets,
+	})
+}
+
+// patchZone applies the REPLACE and DELETE changes all or nothing with the checks PowerDNS does on them.
+func (s *Server) patchZone(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RRSets []struct {
+			RRSet
+			ChangeType string `json:"changetype"`
+		} `json:"rrsets"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rrSets := map[string]*RRSet{}
+	for key, rrSet := range s.rrSets {
+		rrSets[key] = rrSet
+	}
+
+	for _, change := range request.RRSets {
+		rrSet := change.RRSet
+		description := fmt.Sprintf("RRset %s IN %s", rrSet.Name, rrSet.Type)
+
+		if !strings.HasSuffix(rrSet.Name, ".") {
+			writeError(w, http.StatusUnprocessableEntity, description+": Name is not canonical")
+			return
+		}
+
+		if !strings.EqualFold(rrSet.Name, s.zoneName) && !strings.HasSuffix(strings.ToLower(rrSet.Name), "."+strings.ToLower(s.zoneName)) {
+			writeError(w, http.StatusUnprocessableEntity, description+": Name is out of zone")
+			return
+		}
+
+		switch change.ChangeType {
+		case "REPLACE":
+			if len(rrSet.Records) == 0 {
+				writeError(w, http.StatusUnprocessableEntity, description+": no records given")
+				return
+			}
+			if rrSet.TTL <= 0 {
+				writeError(w, http.StatusUnprocessableEntity, description+": TTL is not set")
+				return
+			}
+			rrSets[rrSetKey(rrSet.Name, rrSet.Type)] = &rrSet
+		case "DELETE":
+			delete(rrSets, rrSetKey(rrSet.Name, rrSet.Type))
+		default:
+			writeError(w, http.StatusUnprocessableEntity, "Changetype not understood")
+			return
+		}
+	}
+
+	s.rrSets = rrSets
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func rrSetKey(name string, rrType string) string {
+	return strings.ToLower(fqdn(name)) + "|" + rrType
+}
@@ -0,0 +1,372 @@
+// Package fakeroute53 serves the subset of the Route 53 REST API used by the dyndns server from a local httptest
+// server, so the route53 backend can be exercised without network access or an AWS account.
+package fakeroute53
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Operation string
+
+const (
+	OperationGetHostedZone          Operation = "GetHostedZone"
+	OperationListResourceRecordSets Operation = "ListResourceRecordSets"
+	OperationChange                 Operation = "ChangeResourceRecordSets"
+	OperationGetChange              Operation = "GetChange"
+)
+
+// Record is a resource record set as Route 53 stores it, the name with trailing dot.
+type Record struct {
+	Name   string   `xml:"Name"`
+	Type   string   `xml:"Type"`
+	TTL    int64    `xml:"TTL"`
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+// Server is an in-process stand-in for the Route 53 API serving a single hosted zone.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	accessKeyID  string
+	zoneID       string
+	zoneName     string
+	records      map[string]*Record
+	changes      map[string]int
+	nextChange   int
+	pendingPolls int
+	failures     map[Operation]int
+	calls        map[Operation]int
+}
+
+// NewServer starts a fake Route 53 API for the hosted zone zoneName (e.g. "example.com.") with the ID zoneID that
+// only accepts requests signed with accessKeyID. Close the server when done.
+func NewServer(accessKeyID string, zoneID string, zoneName string) *Server {
+	s := &Server{
+		accessKeyID: accessKeyID,
+		zoneID:      zoneID,
+		zoneName:    fqdn(zoneName),
+		records:     map[string]*Record{},
+		changes:     map[string]int{},
+		failures:    map[Operation]int{},
+		calls:       map[Operation]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /2013-04-01/hostedzone/{zone}", s.handle(OperationGetHostedZone, s.getHostedZone))
+	mux.HandleFunc("GET /2013-04-01/hostedzone/{zone}/rrset", s.handle(OperationListResourceRecordSets, s.listResourceRecordSets))
+	mux.HandleFunc("POST /2013-04-01/hostedzone/{zone}/rrset", s.handle(OperationChange, s.changeResourceRecordSets))
+	mux.HandleFunc("GET /2013-04-01/change/{change}", s.handle(OperationGetChange, s.getChange))
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Endpoint is the base URL to use as route53-endpoint.
+func (s *Server) Endpoint() string {
+	return s.URL
+}
+
+// FailOperation makes every following call of op answer with the given HTTP status until ClearFailures is called.
+// Route 53 clients retry 5xx answers, so tests should use 4xx ones.
+func (s *Server) FailOperation(op Operation, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[op] = status
+}
+
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = map[Operation]int{}
+}
+
+// SetPendingPolls makes the following changes report PENDING for the first n GetChange calls, INSYNC afterwards.
+func (s *Server) SetPendingPolls(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingPolls = n
+}
+
+// Calls returns how often op was requested.
+func (s *Server) Calls(op Operation) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// SetRecord stores a record set, replacing an existing one of the same name and type.
+func (s *Server) SetRecord(name string, rrType string, ttl int64, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[recordKey(name, rrType)] = &Record{Name: fqdn(name), Type: rrType, TTL: ttl, Values: values}
+}
+
+// Record returns a copy of the record set with the given name and type or nil.
+func (s *Server) Record(name string, rrType string) *Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[recordKey(name, rrType)]
+	if !ok {
+		return nil
+	}
+
+	c := *record
+	c.Values = append([]string(nil), record.Values...)
+	return &c
+}
+
+func (s *Server) handle(op Operation, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[op]++
+		status := s.failures[op]
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, "InjectedFailure", fmt.Sprintf("injected failure for %s", op))
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.accessKeyID+"/") {
+			writeError(w, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid.")
+			return
+		}
+
+		if zone := r.PathValue("zone"); op != OperationGetChange && zone != s.zoneID {
+			writeError(w, http.StatusNotFound, "NoSuchHostedZone", "No hosted zone found with ID: "+zone)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) getHostedZone(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName         xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ GetHostedZoneResponse"`
+		ID              string   `xml:"HostedZone>Id"`
+		Name            string   `xml:"HostedZone>Name"`
+		CallerReference string   `xml:"HostedZone>CallerReference"`
+		RecordCount     int      `xml:"HostedZone>ResourceRecordSetCount"`
+	}{
+		ID:              "/hostedzone/" + s.zoneID,
+		Name:            s.zoneName,
+		CallerReference: "fakeroute53",
+		RecordCount:     len(s.records),
+	})
+}
+
+// listResourceRecordSets returns the record sets at or after name and type in the order of Route 53, which compares
+// the labels of the names from right to left.
+func (s *Server) listResourceRecordSets(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxItems, err := strconv.Atoi(r.URL.Query().Get("maxitems"))
+	if err != nil || maxItems <= 0 || maxItems > 300 {
+		maxItems = 300
+	}
+
+	start := sortKey(r.URL.Query().Get("name"), r.URL.Query().Get("type"))
+
+	var records []*Record
+	for _, record := range s.records {
+		if sortKey(record.Name, record.Type) >= start {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return sortKey(records[i].Name, records[i].Type) < sortKey(records[j].Name, records[j].Type)
+	})
+
+	response := struct {
+		XMLName        xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ListResourceRecordSetsResponse"`
+		Records        []Record `xml:"ResourceRecordSets>ResourceRecordSet"`
+		IsTruncated    bool     `xml:"IsTruncated"`
+		NextRecordName string   `xml:"NextRecordName,omitempty"`
+		NextRecordType string   `xml:"NextRecordType,omitempty"`
+		MaxItems       int      `xml:"MaxItems"`
+	}{
+		Records:  []Record{},
+		MaxItems: maxItems,
+	}
+
+	for i, record := range records {
+		if i == maxItems {
+			response.IsTruncated = true
+			response.NextRecordName = record.Name
+			response.NextRecordType = record.Type
+			break
+		}
+		response.Records = append(response.Records, *record)
+	}
+
+	writeXML(w, http.StatusOK, response)
+}
+
+// changeResourceRecordSets applies the batch all or nothing with the checks Route 53 does on CREATE and DELETE.
+func (s *Server) changeResourceRecordSets(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Changes []struct {
+			Action string `xml:"Action"`
+			Record Record `xml:"ResourceRecordSet"`
+		} `xml:"ChangeBatch>Changes>Change"`
+	}
+
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidInput", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := map[string]*Record{}
+	for key, record := range s.records {
+		records[key] = record
+	}
+
+	var messages []string
+
+	for _, change := range request.Changes {
+		record := change.Record
+		record.Name = fqdn(record.Name)
+		key := recordKey(record.Name, record.Type)
+		existing := records[key]
+		description := fmt.Sprintf("resource record set [name='%s', type='%s']", record.Name, record.Type)
+
+		if record.Name != s.zoneName && !strings.HasSuffix(strings.ToLower(record.Name), "."+strings.ToLower(s.zoneName)) {
+			messages = append(messages, fmt.Sprintf("RRSet with DNS name %s is not permitted in zone %s", record.Name, s.zoneName))
+			continue
+		}
+
+		switch change.Action {
+		case "CREATE":
+			if existing != nil {
+				messages = append(messages, "Tried to create "+description+" but it already exists")
+				continue
+			}
+			records[key] = &record
+		case "UPSERT":
+			records[key] = &record
+		case "DELETE":
+			if existing == nil {
+				messages = append(messages, "Tried to delete "+description+" but it was not found")
+				continue
+			}
+			if existing.TTL != record.TTL || strings.Join(existing.Values, ",") != strings.Join(record.Values, ",") {
+				messages = append(messages, "Tried to delete "+description+" but the values provided do not match the current values")
+				continue
+			}
+			delete(records, key)
+		default:
+			messages = append(messages, "Invalid action "+change.Action)
+		}
+	}
+
+	if len(messages) > 0 {
+		writeXML(w, http.StatusBadRequest, struct {
+			XMLName  xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ InvalidChangeBatch"`
+			Messages []string `xml:"Messages>Message"`
+		}{Messages: messages})
+		return
+	}
+
+	s.records = records
+	s.nextChange++
+	id := fmt.Sprintf("C%013d", s.nextChange)
+	s.changes[id] = s.pendingPolls
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name   `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsResponse"`
+		Info    changeInfo `xml:"ChangeInfo"`
+	}{Info: newChangeInfo(id, "PENDING")})
+}
+
+func (s *Server) getChange(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("change")
+	pending, ok := s.changes[id]
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchChange", "Could not find resource with ID: "+id)
+		return
+	}
+
+	status := "INSYNC"
+	if pending > 0 {
+		status = "PENDING"
+		s.changes[id] = pending - 1
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name   `xml:"https://route53.amazonaws.com/doc/2013-04-01/ GetChangeResponse"`
+		Info    changeInfo `xml:"ChangeInfo"`
+	}{Info: newChangeInfo(id, status)})
+}
+
+type changeInfo struct {
+	ID          string `xml:"Id"`
+	Status      string `xml:"Status"`
+	SubmittedAt string `xml:"SubmittedAt"`
+}
+
+func newChangeInfo(id string, status string) changeInfo {
+	return changeInfo{ID: "/change/" + id, Status: status, SubmittedAt: time.Now().UTC().Format(time.RFC3339)}
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeXML(w, status, struct {
+		XMLName   xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ErrorResponse"`
+		Type      string   `xml:"Error>Type"`
+		Code      string   `xml:"Error>Code"`
+		Message   string   `xml:"Error>Message"`
+		RequestID string   `xml:"RequestId"`
+	}{Type: "Sender", Code: code, Message: message, RequestID: "fakeroute53"})
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func recordKey(name string, rrType string) string {
+	return strings.ToLower(fqdn(name)) + "|" + rrType
+}
+
+// sortKey orders names by their labels from right to left, then by type.
+func sortKey(name string, rrType string) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".")
+
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	return strings.Join(labels, ".") + "|" + rrType
+}
@@ -0,0 +1,331 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMemoryRecordNotFound = errors.New("resource record set not found")
+	ErrMemoryRecordExists   = errors.New("resource record set already exists")
+	ErrMemoryInjected       = errors.New("injected API error")
+)
+
+const (
+	MemoryOperationGet    = "get"
+	MemoryOperationCreate = "create"
+	MemoryOperationPatch  = "patch"
+	MemoryOperationDelete = "delete"
+	MemoryDefaultTTL      = 60
+)
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "memory",
+		Description: "In-memory fake for local development and tests",
+		Options: []ProviderOption{
+			{Name: "memory-latency", Env: "DYNDNS_MEMORY_LATENCY", Default: "0s", Usage: "Simulated latency of every API call"},
+			{Name: "memory-error-rate", Env: "DYNDNS_MEMORY_ERROR_RATE", Default: "0", Usage: "Probability (0-1) that an API call fails"},
+			{Name: "memory-fail", Env: "DYNDNS_MEMORY_FAIL", Usage: "Comma separated API operations that always fail (get,create,patch,delete)"},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			latency, err := time.ParseDuration(cfg.Get("memory-latency"))
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid memory-latency: %v", err)
+			}
+
+			errorRate, err := strconv.ParseFloat(cfg.Get("memory-error-rate"), 64)
+			if err != nil || errorRate < 0 || errorRate > 1 {
+				return nil, fmt.Errorf("[DynDNS Server] invalid memory-error-rate: %q", cfg.Get("memory-error-rate"))
+			}
+
+			return NewMemoryService(cfg.DomainName, &MemoryOptions{
+				Latency:   latency,
+				ErrorRate: errorRate,
+				Fail:      splitList(cfg.Get("memory-fail")),
+			}), nil
+		},
+		Stateful: true,
+	})
+}
+
+// MemoryOptions controls the simulated behaviour of a MemoryService.
+type MemoryOptions struct {
+	Latency   time.Duration
+	ErrorRate float64
+	Fail      []string
+}
+
+// MemoryService is a DynDNSService that keeps its record sets in memory. It mimics the get/create/patch semantics
+// of Cloud DNS, so it can be used to run the server and its routes without a Google project.
+type MemoryService struct {
+	mu         sync.RWMutex
+	domainName string
+	options    MemoryOptions
+	records    map[string]memoryRecord
+	rand       *rand.Rand
+}
+
+type memoryRecord struct {
+	value string
+	ttl   int
+}
+
+func NewMemoryService(domainName string, options *MemoryOptions) *MemoryService {
+	if options == nil {
+		options = &MemoryOptions{}
+	}
+
+	return &MemoryService{
+		domainName: domainName,
+		options:    *options,
+		records:    map[string]memoryRecord{},
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetOptions replaces the simulated latency and error behaviour.
+func (m *MemoryService) SetOptions(options MemoryOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.options = options
+}
+
+// Record returns the value currently stored for the given name and type.
+func (m *MemoryService) Record(name string, rrType string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.records[memoryKey(name, rrType)]
+	return record.value, ok
+}
+
+func (m *MemoryService) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
+
+	if ipAddress == "" && ipv6Address == "" {
+		return nil, nil
+	}
+
+	var result, v6Result *UpdateResult
+
+	if ipAddress != "" {
+		result = m.updateRecord(hostname, "A", ipAddress, ttl)
+	}
+
+	if ipv6Address != "" {
+		v6Result = m.updateRecord(hostname, "AAAA", ipv6Address, ttl)
+	}
+
+	return result, v6Result
+}
+
+func (m *MemoryService) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = m.removeRecord(hostname, "A")
+	}
+
+	if v6 {
+		v6Result = m.removeRecord(hostname, "AAAA")
+	}
+
+	return result, v6Result
+}
+
+func (m *MemoryService) ValidateCredentials() error {
+	testName := fmt.Sprintf("%s.%d.%s", DNSCredentialValidationRecord, time.Now().Unix(), m.domainName)
+
+	if err := m.create(testName, "A", DNSCredentialValidationIP, MemoryDefaultTTL); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
+	}
+
+	if err := m.delete(testName, "A"); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+	}
+
+	return nil
+}
+
+// CheckHealth simulates a get, so memory-fail=get makes the backend unhealthy.
+func (m *MemoryService) CheckHealth() error {
+	if err := m.simulate(MemoryOperationGet); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+	}
+
+	return nil
+}
+
+func (m *MemoryService) updateRecord(name string, rrType string, value string, ttl int) *UpdateResult {
+	if ttl == 0 {
+		ttl = MemoryDefaultTTL
+	}
+
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+		Value:  value,
+		TTL:    ttl,
+	}
+
+	current, err := m.get(name, rrType)
+
+	if err != nil {
+		if !errors.Is(err, ErrMemoryRecordNotFound) {
+			result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+			return result
+		}
+
+		if err := m.create(name, rrType, value, ttl); err != nil {
+			result.Error = fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
+			return result
+		}
+
+		result.Created = true
+		result.Success = true
+		return result
+	}
+
+	result.PreviousValue = current.value
+
+	if current.value == value && current.ttl == ttl {
+		result.Unchanged = true
+		result.Success = true
+		return result
+	}
+
+	if err := m.patch(name, rrType, value, ttl); err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to patch resource record set: %v", err)
+		return result
+	}
+
+	result.Updated = true
+	result.Success = true
+	return result
+}
+
+func (m *MemoryService) removeRecord(name string, rrType string) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+	}
+
+	current, err := m.get(name, rrType)
+
+	if err != nil {
+		if !errors.Is(err, ErrMemoryRecordNotFound) {
+			result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+			return result
+		}
+
+		result.Success = true
+		return result
+	}
+
+	result.PreviousValue = current.value
+
+	if err := m.delete(name, rrType); err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+		return result
+	}
+
+	result.Deleted = true
+	result.Success = true
+	return result
+}
+
+func (m *MemoryService) get(name string, rrType string) (memoryRecord, error) {
+	if err := m.simulate(MemoryOperationGet); err != nil {
+		return memoryRecord{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.records[memoryKey(name, rrType)]
+	if !ok {
+		return memoryRecord{}, ErrMemoryRecordNotFound
+	}
+	return record, nil
+}
+
+func (m *MemoryService) create(name string, rrType string, value string, ttl int) error {
+	if err := m.simulate(MemoryOperationCreate); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(name, rrType)
+	if _, exists := m.records[key]; exists {
+		return ErrMemoryRecordExists
+	}
+	m.records[key] = memoryRecord{value: value, ttl: ttl}
+	return nil
+}
+
+func (m *MemoryService) patch(name string, rrType string, value string, ttl int) error {
+	if err := m.simulate(MemoryOperationPatch); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(name, rrType)
+	if _, exists := m.records[key]; !exists {
+		return ErrMemoryRecordNotFound
+	}
+	m.records[key] = memoryRecord{value: value, ttl: ttl}
+	return nil
+}
+
+func (m *MemoryService) delete(name string, rrType string) error {
+	if err := m.simulate(MemoryOperationDelete); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(name, rrType)
+	if _, exists := m.records[key]; !exists {
+		return ErrMemoryRecordNotFound
+	}
+	delete(m.records, key)
+	return nil
+}
+
+// simulate applies the configured latency and decides whether the operation fails.
+func (m *MemoryService) simulate(operation string) error {
+	m.mu.Lock()
+	options := m.options
+	roll := m.rand.Float64()
+	m.mu.Unlock()
+
+	if options.Latency > 0 {
+		time.Sleep(options.Latency)
+	}
+
+	for _, op := range options.Fail {
+		if op == operation {
+			return fmt.Errorf("%w: %s", ErrMemoryInjected, operation)
+		}
+	}
+
+	if roll < options.ErrorRate {
+		return fmt.Errorf("%w: %s", ErrMemoryInjected, operation)
+	}
+
+	return nil
+}
+
+func memoryKey(name string, rrType string) string {
+	return strings.ToLower(name) + "/" + rrType
+}
@@ -0,0 +1,129 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	"testing"
+)
+
+func TestMemoryUpdate(t *testing.T) {
+	service := dns.NewMemoryService(testHostname, nil)
+
+	result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || !r.Created || r.TTL != dns.MemoryDefaultTTL {
+			t.Fatalf("%s result = %+v, want created", r.RRType, r)
+		}
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if !result.Success || !result.Unchanged || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want unchanged", result)
+	}
+
+	// A new TTL alone is a change
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 300)
+
+	if !result.Success || !result.Updated || result.TTL != 300 {
+		t.Fatalf("A result = %+v, want updated", result)
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Updated || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want updated from 192.0.2.1", result)
+	}
+
+	if value, _ := service.Record(testHostname, "A"); value != "192.0.2.2" {
+		t.Fatalf("A record = %s, want 192.0.2.2", value)
+	}
+}
+
+func TestMemoryDelete(t *testing.T) {
+	service := dns.NewMemoryService(testHostname, nil)
+	service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, true)
+
+	if !result.Success || !result.Deleted || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want deleted", result)
+	}
+
+	if !v6Result.Success || v6Result.Deleted {
+		t.Fatalf("AAAA result = %+v, want success without deletion", v6Result)
+	}
+
+	if _, ok := service.Record(testHostname, "A"); ok {
+		t.Fatal("A record still exists")
+	}
+}
+
+func TestMemoryFail(t *testing.T) {
+	tests := []struct {
+		op       string
+		existing bool
+		check    func(service *dns.MemoryService) error
+	}{
+		{dns.MemoryOperationGet, false, func(service *dns.MemoryService) error { return service.CheckHealth() }},
+		{dns.MemoryOperationCreate, false, func(service *dns.MemoryService) error { return service.ValidateCredentials() }},
+		{dns.MemoryOperationPatch, true, func(service *dns.MemoryService) error {
+			result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 0)
+			return result.Error
+		}},
+		{dns.MemoryOperationDelete, true, func(service *dns.MemoryService) error {
+			result, _ := service.DeleteDNSRecord(testHostname, true, false)
+			return result.Error
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			service := dns.NewMemoryService(testHostname, nil)
+
+			if tt.existing {
+				service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+			}
+
+			service.SetOptions(dns.MemoryOptions{Fail: []string{tt.op}})
+
+			if err := tt.check(service); err == nil {
+				t.Fatalf("%s succeeded, want the injected error", tt.op)
+			}
+
+			if value, _ := service.Record(testHostname, "A"); tt.existing && value != "192.0.2.1" {
+				t.Fatalf("A record = %s, want 192.0.2.1 kept", value)
+			}
+		})
+	}
+}
+
+func TestMemoryErrorRate(t *testing.T) {
+	service := dns.NewMemoryService(testHostname, &dns.MemoryOptions{ErrorRate: 1})
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if result.Success || result.Error == nil {
+		t.Fatalf("A result = %+v, want failure", result)
+	}
+
+	service.SetOptions(dns.MemoryOptions{})
+
+	if err := service.CheckHealth(); err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+}
+
+func TestMemoryValidateCredentials(t *testing.T) {
+	service := dns.NewMemoryService(testHostname, nil)
+
+	if err := service.ValidateCredentials(); err != nil {
+		t.Fatalf("ValidateCredentials: %v", err)
+	}
+
+	service.SetOptions(dns.MemoryOptions{Fail: []string{dns.MemoryOperationDelete}})
+
+	if err := service.ValidateCredentials(); err == nil {
+		t.Fatal("ValidateCredentials succeeded although the delete failed")
+	}
+}
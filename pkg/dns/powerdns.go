@@ -0,0 +1,346 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	PowerDNSDefaultTTL = 60
+)
+
+var (
+	ErrPowerDNSAPI = errors.New("powerdns API error")
+)
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "powerdns",
+		Description: "PowerDNS Authoritative HTTP API",
+		Options: []ProviderOption{
+			{Name: "powerdns-url", Env: "DYNDNS_POWERDNS_URL", Usage: "Base URL of the PowerDNS API, e.g. http://127.0.0.1:8081", Required: true},
+			{Name: "powerdns-api-key", Env: "DYNDNS_POWERDNS_API_KEY", Usage: "PowerDNS API key (X-API-Key)", Required: true, Secret: true},
+			{Name: "powerdns-server-id", Env: "DYNDNS_POWERDNS_SERVER_ID", Default: "localhost", Usage: "PowerDNS server ID"},
+			{Name: "powerdns-zone", Env: "DYNDNS_POWERDNS_ZONE", Usage: "Zone to update, e.g. mydomain.tld", Required: true},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			return NewPowerDNSService(&PowerDNSConfig{
+				URL:      cfg.Get("powerdns-url"),
+				APIKey:   cfg.Get("powerdns-api-key"),
+				ServerID: cfg.Get("powerdns-server-id"),
+				Zone:     cfg.Get("powerdns-zone"),
+			}, cfg.DomainName)
+		},
+	})
+}
+
+type PowerDNSConfig struct {
+	URL      string
+	APIKey   string
+	ServerID string
+	Zone     string
+}
+
+type powerDNSService struct {
+	client     *resty.Client
+	zonePath   string
+	domainName string
+}
+
+type powerDNSRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type powerDNSRRSet struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	TTL        int              `json:"ttl,omitempty"`
+	ChangeType string           `json:"changetype,omitempty"`
+	Records    []powerDNSRecord `json:"records"`
+}
+
+type powerDNSZone struct {
+	Name   string          `json:"name"`
+	RRSets []powerDNSRRSet `json:"rrsets"`
+}
+
+type powerDNSError struct {
+	Error string `json:"error"`
+}
+
+func NewPowerDNSService(cfg *PowerDNSConfig, domainName string) (DynDNSService, error) {
+
+	if cfg.ServerID == "" {
+		cfg.ServerID = "localhost"
+	}
+
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(cfg.URL, "/"))
+	client.SetHeader("X-API-Key", cfg.APIKey)
+	client.SetHeader("Content-Type", "application/json")
+	client.SetTimeout(30 * time.Second)
+	client.SetDisableWarn(true)
+
+	return &powerDNSService{
+		client:     client,
+		zonePath:   fmt.Sprintf("/api/v1/servers/%s/zones/%s", url.PathEscape(cfg.ServerID), url.PathEscape(powerDNSFqdn(cfg.Zone))),
+		domainName: powerDNSFqdn(domainName),
+	}, nil
+}
+
+func (s *powerDNSService) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
+
+	if ipAddress == "" && ipv6Address == "" {
+		return nil, nil
+	}
+
+	var result, v6Result *UpdateResult
+
+	if ipAddress != "" {
+		result = s.updateRecord(hostname, "A", ipAddress, ttl)
+	}
+
+	if ipv6Address != "" {
+		v6Result = s.updateRecord(hostname, "AAAA", ipv6Address, ttl)
+	}
+
+	return result, v6Result
+}
+
+func (s *powerDNSService) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = s.removeRecord(hostname, "A")
+	}
+
+	if v6 {
+		v6Result = s.removeRecord(hostname, "AAAA")
+	}
+
+	return result, v6Result
+}
+
+// CheckHealth reads the metadata of the zone. The record sets are left out, which would otherwise be the whole zone.
+func (s *powerDNSService) CheckHealth() error {
+	var apiError powerDNSError
+
+	response, err := s.client.R().
+		SetQueryParam("rrsets", "false").
+		SetError(&apiError).
+		ForceContentType("application/json").
+		Get(s.zonePath)
+	if err == nil && !response.IsSuccess() {
+		err = powerDNSResponseError(response, &apiError)
+	}
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to get zone: %v", err)
+	}
+
+	return nil
+}
+
+func (s *powerDNSService) ValidateCredentials() error {
+
+	// Read Test
+	if err := s.CheckHealth(); err != nil {
+		return err
+	}
+
+	testName := fmt.Sprintf("%s.%d.%s", DNSCredentialValidationRecord, time.Now().Unix(), s.domainName)
+
+	// Write Test
+	err := s.patch(powerDNSRRSet{
+		Name:       testName,
+		Type:       "A",
+		TTL:        300,
+		ChangeType: "REPLACE",
+		Records:    []powerDNSRecord{{Content: DNSCredentialValidationIP}},
+	})
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
+	}
+
+	// Cleanup
+	err = s.patch(powerDNSRRSet{
+		Name:       testName,
+		Type:       "A",
+		ChangeType: "DELETE",
+		Records:    []powerDNSRecord{},
+	})
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+	}
+
+	return nil
+}
+
+// updateRecord replaces the RRset with a PATCH of changetype REPLACE. The zone is read beforehand to skip writes
+// that change nothing and to report Created vs Updated the same way as the other backends.
+func (s *powerDNSService) updateRecord(name string, rrType string, value string, ttl int) *UpdateResult {
+	if ttl == 0 {
+		ttl = PowerDNSDefaultTTL
+	}
+
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+		Value:  value,
+		TTL:    ttl,
+	}
+
+	zone, err := s.getZone(name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+		return result
+	}
+
+	exists := false
+	for _, rrSet := range zone.RRSets {
+		if !strings.EqualFold(rrSet.Name, name) || rrSet.Type != rrType {
+			continue
+		}
+
+		exists = true
+
+		var contents []string
+		for _, record := range rrSet.Records {
+			contents = append(contents, record.Content)
+		}
+		result.PreviousValue = strings.Join(contents, ",")
+
+		if rrSet.TTL == ttl && result.PreviousValue == value {
+			result.Unchanged = true
+			result.Success = true
+			return result
+		}
+		break
+	}
+
+	err = s.patch(powerDNSRRSet{
+		Name:       name,
+		Type:       rrType,
+		TTL:        ttl,
+		ChangeType: "REPLACE",
+		Records:    []powerDNSRecord{{Content: value}},
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to replace resource record set: %v", err)
+		return result
+	}
+
+	if exists {
+		result.Updated = true
+	} else {
+		result.Created = true
+	}
+	result.Success = true
+
+	return result
+}
+
+// removeRecord deletes the RRset with a PATCH of changetype DELETE if the zone contains it.
+func (s *powerDNSService) removeRecord(name string, rrType string) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+	}
+
+	zone, err := s.getZone(name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+		return result
+	}
+
+	for _, rrSet := range zone.RRSets {
+		if !strings.EqualFold(rrSet.Name, name) || rrSet.Type != rrType {
+			continue
+		}
+
+		var contents []string
+		for _, record := range rrSet.Records {
+			contents = append(contents, record.Content)
+		}
+		result.PreviousValue = strings.Join(contents, ",")
+
+		err = s.patch(powerDNSRRSet{
+			Name:       name,
+			Type:       rrType,
+			ChangeType: "DELETE",
+			Records:    []powerDNSRecord{},
+		})
+		if err != nil {
+			result.Error = fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+			return result
+		}
+
+		result.Deleted = true
+		break
+	}
+
+	result.Success = true
+	return result
+}
+
+// getZone reads the zone. Newer PowerDNS versions only return the RRsets matching name and type if both are given,
+// older ones ignore the filter, so callers must filter the result themselves.
+func (s *powerDNSService) getZone(name string, rrType string) (*powerDNSZone, error) {
+	var zone powerDNSZone
+	var apiError powerDNSError
+
+	request := s.client.R().SetResult(&zone).SetError(&apiError).ForceContentType("application/json")
+	if name != "" && rrType != "" {
+		request.SetQueryParams(map[string]string{"rrset_name": name, "rrset_type": rrType})
+	}
+
+	response, err := request.Get(s.zonePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.IsSuccess() {
+		return nil, powerDNSResponseError(response, &apiError)
+	}
+
+	return &zone, nil
+}
+
+func (s *powerDNSService) patch(rrSets ...powerDNSRRSet) error {
+	var apiError powerDNSError
+
+	response, err := s.client.R().
+		SetBody(map[string]interface{}{"rrsets": rrSets}).
+		SetError(&apiError).
+		ForceContentType("application/json").
+		Patch(s.zonePath)
+	if err != nil {
+		return err
+	}
+
+	if !response.IsSuccess() {
+		return powerDNSResponseError(response, &apiError)
+	}
+
+	return nil
+}
+
+func powerDNSResponseError(response *resty.Response, apiError *powerDNSError) error {
+	if apiError.Error != "" {
+		return fmt.Errorf("%w: %s: %s", ErrPowerDNSAPI, response.Status(), apiError.Error)
+	}
+	return fmt.Errorf("%w: %s", ErrPowerDNSAPI, response.Status())
+}
+
+func powerDNSFqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
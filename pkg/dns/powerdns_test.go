@@ -0,0 +1,204 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	"dyndns/pkg/dns/fakepowerdns"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testPowerDNSAPIKey = "powerdns-key"
+
+func newPowerDNSService(t *testing.T, apiKey string) (dns.DynDNSService, *fakepowerdns.Server) {
+	t.Helper()
+
+	srv := fakepowerdns.NewServer(testPowerDNSAPIKey, "example.com.")
+	t.Cleanup(srv.Close)
+
+	service, err := dns.NewPowerDNSService(&dns.PowerDNSConfig{
+		URL:    srv.Endpoint(),
+		APIKey: apiKey,
+		Zone:   "example.com",
+	}, testHostname)
+
+	if err != nil {
+		t.Fatalf("NewPowerDNSService: %v", err)
+	}
+
+	return service, srv
+}
+
+func assertPowerDNSRecord(t *testing.T, srv *fakepowerdns.Server, name string, rrType string, ttl int, content string) {
+	t.Helper()
+
+	rrSet := srv.Record(name, rrType)
+
+	if rrSet == nil {
+		t.Fatalf("%s %s record missing", name, rrType)
+	}
+
+	if rrSet.TTL != ttl || len(rrSet.Records) != 1 || rrSet.Records[0].Content != content {
+		t.Fatalf("%s %s record = ttl %d %+v, want ttl %d [%s]", name, rrType, rrSet.TTL, rrSet.Records, ttl, content)
+	}
+}
+
+func TestPowerDNSCreate(t *testing.T) {
+	service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+
+	result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || !r.Created || r.Updated || r.PreviousValue != "" {
+			t.Fatalf("%s result = %+v, want created", r.RRType, r)
+		}
+	}
+
+	assertPowerDNSRecord(t, srv, testHostname, "A", dns.PowerDNSDefaultTTL, "192.0.2.1")
+	assertPowerDNSRecord(t, srv, testHostname, "AAAA", dns.PowerDNSDefaultTTL, "2001:db8::1")
+}
+
+func TestPowerDNSUpdate(t *testing.T) {
+	service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+	srv.SetRecord(testHostname, "A", 300, "192.0.2.1")
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Updated || result.Created || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want updated from 192.0.2.1", result)
+	}
+
+	assertPowerDNSRecord(t, srv, testHostname, "A", 300, "192.0.2.2")
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Unchanged || result.Updated {
+		t.Fatalf("A result = %+v, want unchanged", result)
+	}
+
+	if calls := srv.Calls(fakepowerdns.OperationPatchZone); calls != 1 {
+		t.Fatalf("PATCH called %d times, want 1", calls)
+	}
+}
+
+func TestPowerDNSIgnoredFilter(t *testing.T) {
+	service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+	srv.IgnoreRRSetFilter()
+
+	// Without the filter the whole zone is returned, only the RRset of the name and type counts
+	srv.SetRecord("cabin.example.com.", "A", 60, "192.0.2.8")
+	srv.SetRecord("www.home.example.com.", "A", 60, "192.0.2.9")
+	srv.SetRecord(testHostname, "AAAA", 60, "2001:db8::1")
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 60)
+
+	if !result.Success || !result.Unchanged || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want unchanged", result)
+	}
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, false)
+
+	if v6Result != nil || !result.Success || !result.Deleted || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want deleted", result)
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 60)
+
+	if !result.Success || !result.Created || result.PreviousValue != "" {
+		t.Fatalf("A result = %+v, want created", result)
+	}
+
+	assertPowerDNSRecord(t, srv, "cabin.example.com.", "A", 60, "192.0.2.8")
+	assertPowerDNSRecord(t, srv, "www.home.example.com.", "A", 60, "192.0.2.9")
+	assertPowerDNSRecord(t, srv, testHostname, "AAAA", 60, "2001:db8::1")
+}
+
+func TestPowerDNSAPIErrors(t *testing.T) {
+	tests := []struct {
+		op     fakepowerdns.Operation
+		status int
+	}{
+		{fakepowerdns.OperationGetZone, http.StatusInternalServerError},
+		{fakepowerdns.OperationPatchZone, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.op)+" "+http.StatusText(tt.status), func(t *testing.T) {
+			service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+			srv.FailOperation(tt.op, tt.status)
+
+			result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+			if result.Success || result.Created || result.Error == nil || !strings.Contains(result.Error.Error(), "injected failure") {
+				t.Fatalf("A result = %+v, want the API error", result)
+			}
+
+			if srv.Record(testHostname, "A") != nil {
+				t.Fatal("A record created despite the failure")
+			}
+		})
+	}
+}
+
+func TestPowerDNSInvalidAPIKey(t *testing.T) {
+	service, _ := newPowerDNSService(t, "wrong")
+
+	if err := service.CheckHealth(); err == nil {
+		t.Fatal("CheckHealth succeeded with an invalid API key")
+	}
+
+	if err := service.ValidateCredentials(); err == nil {
+		t.Fatal("ValidateCredentials succeeded with an invalid API key")
+	}
+}
+
+func TestPowerDNSValidateCredentials(t *testing.T) {
+	service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+
+	if err := service.ValidateCredentials(); err != nil {
+		t.Fatalf("ValidateCredentials: %v", err)
+	}
+
+	if calls := srv.Calls(fakepowerdns.OperationPatchZone); calls != 2 {
+		t.Fatalf("PATCH called %d times, want a create and a delete", calls)
+	}
+}
+
+func TestPowerDNSDelete(t *testing.T) {
+	service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+	srv.SetRecord(testHostname, "AAAA", 60, "2001:db8::1")
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, false)
+
+	if v6Result != nil {
+		t.Fatalf("AAAA result = %+v, want nil", v6Result)
+	}
+
+	if !result.Success || !result.Deleted || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want deleted", result)
+	}
+
+	if srv.Record(testHostname, "A") != nil {
+		t.Fatal("A record still exists")
+	}
+
+	assertPowerDNSRecord(t, srv, testHostname, "AAAA", 60, "2001:db8::1")
+}
+
+func TestPowerDNSDeleteMissing(t *testing.T) {
+	service, srv := newPowerDNSService(t, testPowerDNSAPIKey)
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, true)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || r.Deleted || r.Error != nil {
+			t.Fatalf("%s result = %+v, want success without deletion", r.RRType, r)
+		}
+	}
+
+	if calls := srv.Calls(fakepowerdns.OperationPatchZone); calls != 0 {
+		t.Fatalf("PATCH called %d times, want 0", calls)
+	}
+}
@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrProviderNotFound = errors.New("dns provider not found")
+)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]*Provider{}
+)
+
+// RegisterProvider makes a DNS backend available by name. It panics if the name is empty or already taken.
+func RegisterProvider(p *Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if p == nil || p.Name == "" {
+		panic("[DynDNS Server] RegisterProvider: provider name is required")
+	}
+
+	if _, exists := providers[p.Name]; exists {
+		panic(fmt.Sprintf("[DynDNS Server] RegisterProvider: provider %q registered twice", p.Name))
+	}
+
+	providers[p.Name] = p
+}
+
+func GetProvider(name string) (*Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrProviderNotFound, name)
+	}
+	return p, nil
+}
+
+// Providers returns the registered providers sorted by name.
+func Providers() []*Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	var list []*Provider
+	for _, p := range providers {
+		list = append(list, p)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// CredentialsFingerprint hashes the credential files of the named provider. It changes when a file is created,
+// removed or rewritten, and is empty for providers without credential files.
+func CredentialsFingerprint(name string, cfg *ProviderConfig) string {
+	p, err := GetProvider(name)
+	if err != nil || p.CredentialFiles == nil {
+		return ""
+	}
+
+	files := p.CredentialFiles(cfg)
+	if len(files) == 0 {
+		return ""
+	}
+
+	hash := sha256.New()
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			data = []byte(err.Error())
+		}
+
+		fmt.Fprintf(hash, "%s\x00%x\x00", file, sha256.Sum256(data))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// NewProviderService validates the required options of the named provider and creates its service.
+func NewProviderService(name string, cfg *ProviderConfig) (DynDNSService, error) {
+	p, err := GetProvider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range p.Options {
+		if opt.Required && cfg.Get(opt.Name) == "" {
+			return nil, fmt.Errorf("[DynDNS Server] provider %q requires option --%s", p.Name, opt.Name)
+		}
+	}
+
+	return p.New(cfg)
+}
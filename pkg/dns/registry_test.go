@@ -0,0 +1,47 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredentialsFingerprint(t *testing.T) {
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+
+	cfg := &dns.ProviderConfig{
+		DomainName: testHostname,
+		Options:    map[string]string{"route53-credentials-file": credentialsFile},
+	}
+
+	write := func(content string) {
+		if err := os.WriteFile(credentialsFile, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("[default]\naws_access_key_id = old\n")
+	before := dns.CredentialsFingerprint("route53", cfg)
+
+	if before == "" || dns.CredentialsFingerprint("route53", cfg) != before {
+		t.Fatalf("fingerprint %q is not stable", before)
+	}
+
+	write("[default]\naws_access_key_id = new\n")
+
+	if dns.CredentialsFingerprint("route53", cfg) == before {
+		t.Fatal("fingerprint did not change after rotating the credentials file in place")
+	}
+
+	cfg.Options["route53-access-key-id"] = "static"
+
+	if fingerprint := dns.CredentialsFingerprint("route53", cfg); fingerprint != "" {
+		t.Fatalf("fingerprint = %q with static credentials, want empty", fingerprint)
+	}
+
+	if fingerprint := dns.CredentialsFingerprint("memory", cfg); fingerprint != "" {
+		t.Fatalf("fingerprint = %q for a provider without credential files, want empty", fingerprint)
+	}
+}
@@ -0,0 +1,418 @@
+package dns
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	miekg "github.com/miekg/dns"
+)
+
+const (
+	RFC2136DefaultTTL = 60
+)
+
+var (
+	ErrRFC2136NotInZone = errors.New("record name is not inside the configured zone")
+)
+
+var rfc2136Algorithms = map[string]string{
+	"hmac-md5":    miekg.HmacMD5,
+	"hmac-sha1":   miekg.HmacSHA1,
+	"hmac-sha224": miekg.HmacSHA224,
+	"hmac-sha256": miekg.HmacSHA256,
+	"hmac-sha384": miekg.HmacSHA384,
+	"hmac-sha512": miekg.HmacSHA512,
+}
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "rfc2136",
+		Description: "RFC 2136 dynamic updates signed with TSIG (BIND, Knot, ...)",
+		Options: []ProviderOption{
+			{Name: "rfc2136-server", Env: "DYNDNS_RFC2136_SERVER", Usage: "Primary name server accepting the updates (host:port)", Required: true},
+			{Name: "rfc2136-zone", Env: "DYNDNS_RFC2136_ZONE", Usage: "Zone to update, e.g. mydomain.tld", Required: true},
+			{Name: "rfc2136-tsig-name", Env: "DYNDNS_RFC2136_TSIG_NAME", Usage: "TSIG key name"},
+			{Name: "rfc2136-tsig-secret", Env: "DYNDNS_RFC2136_TSIG_SECRET", Usage: "Base64 encoded TSIG secret", Secret: true},
+			{Name: "rfc2136-tsig-algorithm", Env: "DYNDNS_RFC2136_TSIG_ALGORITHM", Default: "hmac-sha256", Usage: "TSIG algorithm (hmac-sha256, hmac-sha512, ...)"},
+			{Name: "rfc2136-transport", Env: "DYNDNS_RFC2136_TRANSPORT", Default: "tcp", Usage: "Transport used to send the updates (udp or tcp)"},
+			{Name: "rfc2136-timeout", Env: "DYNDNS_RFC2136_TIMEOUT", Default: "10s", Usage: "Timeout of a single update"},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			timeout, err := time.ParseDuration(cfg.Get("rfc2136-timeout"))
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid rfc2136-timeout: %v", err)
+			}
+
+			return NewRFC2136Service(&RFC2136Config{
+				Server:        cfg.Get("rfc2136-server"),
+				Zone:          cfg.Get("rfc2136-zone"),
+				TSIGName:      cfg.Get("rfc2136-tsig-name"),
+				TSIGSecret:    cfg.Get("rfc2136-tsig-secret"),
+				TSIGAlgorithm: cfg.Get("rfc2136-tsig-algorithm"),
+				Transport:     cfg.Get("rfc2136-transport"),
+				Timeout:       timeout,
+			}, cfg.DomainName)
+		},
+	})
+}
+
+type RFC2136Config struct {
+	Server        string
+	Zone          string
+	TSIGName      string
+	TSIGSecret    string
+	TSIGAlgorithm string
+	Transport     string
+	Timeout       time.Duration
+}
+
+type rfc2136Service struct {
+	client     *miekg.Client
+	server     string
+	zone       string
+	tsigName   string
+	tsigAlgo   string
+	domainName string
+}
+
+func NewRFC2136Service(cfg *RFC2136Config, domainName string) (DynDNSService, error) {
+
+	if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+		cfg.Server = net.JoinHostPort(cfg.Server, "53")
+	}
+
+	if cfg.Transport != "udp" && cfg.Transport != "tcp" {
+		return nil, fmt.Errorf("[DynDNS Server] invalid rfc2136 transport %q: use udp or tcp", cfg.Transport)
+	}
+
+	client := &miekg.Client{
+		Net:     cfg.Transport,
+		Timeout: cfg.Timeout,
+	}
+
+	s := &rfc2136Service{
+		client:     client,
+		server:     cfg.Server,
+		zone:       miekg.Fqdn(cfg.Zone),
+		domainName: miekg.Fqdn(domainName),
+	}
+
+	if cfg.TSIGName != "" || cfg.TSIGSecret != "" {
+		if cfg.TSIGName == "" || cfg.TSIGSecret == "" {
+			return nil, errors.New("[DynDNS Server] rfc2136 TSIG requires both a key name and a secret")
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(cfg.TSIGSecret); err != nil {
+			return nil, fmt.Errorf("[DynDNS Server] rfc2136 TSIG secret is not valid base64: %v", err)
+		}
+
+		algorithm, ok := rfc2136Algorithms[strings.ToLower(cfg.TSIGAlgorithm)]
+		if !ok {
+			return nil, fmt.Errorf("[DynDNS Server] unsupported TSIG algorithm %q", cfg.TSIGAlgorithm)
+		}
+
+		s.tsigName = miekg.Fqdn(cfg.TSIGName)
+		s.tsigAlgo = algorithm
+		client.TsigSecret = map[string]string{s.tsigName: cfg.TSIGSecret}
+	}
+
+	if !miekg.IsSubDomain(s.zone, s.domainName) {
+		return nil, fmt.Errorf("[DynDNS Server] %s: %w (%s)", s.domainName, ErrRFC2136NotInZone, s.zone)
+	}
+
+	return s, nil
+}
+
+func (s *rfc2136Service) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
+
+	if ipAddress == "" && ipv6Address == "" {
+		return nil, nil
+	}
+
+	var result, v6Result *UpdateResult
+
+	if ipAddress != "" {
+		result = s.updateRecord(hostname, "A", ipAddress, ttl)
+	}
+
+	if ipv6Address != "" {
+		v6Result = s.updateRecord(hostname, "AAAA", ipv6Address, ttl)
+	}
+
+	return result, v6Result
+}
+
+func (s *rfc2136Service) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = s.removeRecord(hostname, "A")
+	}
+
+	if v6 {
+		v6Result = s.removeRecord(hostname, "AAAA")
+	}
+
+	return result, v6Result
+}
+
+// CheckHealth queries the SOA of the zone. Plain queries are not signed, so it cannot tell whether the TSIG key is
+// still accepted.
+func (s *rfc2136Service) CheckHealth() error {
+	query := new(miekg.Msg)
+	query.SetQuestion(s.zone, miekg.TypeSOA)
+
+	response, _, err := s.client.Exchange(query, s.server)
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to query SOA of %s: %v", s.zone, err)
+	}
+
+	if response.Rcode != miekg.RcodeSuccess {
+		return fmt.Errorf("[DynDNS Server] failed to query SOA of %s: %s", s.zone, miekg.RcodeToString[response.Rcode])
+	}
+
+	return nil
+}
+
+func (s *rfc2136Service) ValidateCredentials() error {
+
+	// Read Test
+	if err := s.CheckHealth(); err != nil {
+		return err
+	}
+
+	testName := fmt.Sprintf("%s.%d.%s", DNSCredentialValidationRecord, time.Now().Unix(), s.zone)
+
+	rr, err := s.newRR(testName, "A", DNSCredentialValidationIP, 300)
+	if err != nil {
+		return err
+	}
+
+	// Write Test
+	update := new(miekg.Msg)
+	update.SetUpdate(s.zone)
+	update.RRsetNotUsed([]miekg.RR{rr})
+	update.Insert([]miekg.RR{rr})
+
+	if err := s.exchange(update); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
+	}
+
+	// Cleanup
+	cleanup := new(miekg.Msg)
+	cleanup.SetUpdate(s.zone)
+	cleanup.RemoveRRset([]miekg.RR{rr})
+
+	if err := s.exchange(cleanup); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+	}
+
+	return nil
+}
+
+// updateRecord reads the RRset first and skips the write if it already holds exactly the record. Otherwise it tries
+// to add the record with the prerequisite that no RRset of that type exists yet. If the server answers YXRRSET, the
+// RRset is replaced with the prerequisite that it exists. Both steps are single atomic UPDATE messages, so concurrent
+// writers cannot interleave between the existence check and the write.
+func (s *rfc2136Service) updateRecord(name string, rrType string, value string, ttl int) *UpdateResult {
+	if ttl == 0 {
+		ttl = RFC2136DefaultTTL
+	}
+
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+		Value:  value,
+		TTL:    ttl,
+	}
+
+	rr, err := s.newRR(name, rrType, value, uint32(ttl))
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	existing, err := s.lookup(name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+		return result
+	}
+
+	result.PreviousValue = rfc2136Values(existing)
+
+	if len(existing) == 1 && existing[0].Header().Ttl == uint32(ttl) && miekg.IsDuplicate(existing[0], rr) {
+		result.Unchanged = true
+		result.Success = true
+		return result
+	}
+
+	create := new(miekg.Msg)
+	create.SetUpdate(s.zone)
+	create.RRsetNotUsed([]miekg.RR{rr})
+	create.Insert([]miekg.RR{rr})
+
+	err = s.exchange(create)
+
+	if err == nil {
+		result.Created = true
+		result.Success = true
+		return result
+	}
+
+	var rcodeErr *rfc2136RcodeError
+	if !errors.As(err, &rcodeErr) || rcodeErr.Rcode != miekg.RcodeYXRrset {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
+		return result
+	}
+
+	replace := new(miekg.Msg)
+	replace.SetUpdate(s.zone)
+	replace.RRsetUsed([]miekg.RR{rr})
+	replace.RemoveRRset([]miekg.RR{rr})
+	replace.Insert([]miekg.RR{rr})
+
+	if err := s.exchange(replace); err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to update resource record set: %v", err)
+		return result
+	}
+
+	result.Updated = true
+	result.Success = true
+	return result
+}
+
+// removeRecord reads the RRset and deletes it with the prerequisite that it still exists, so a record removed by
+// another writer in the meantime is told apart from a deleted one by the NXRRSET answer.
+func (s *rfc2136Service) removeRecord(name string, rrType string) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: rrType,
+	}
+
+	if !miekg.IsSubDomain(s.zone, name) {
+		result.Error = fmt.Errorf("[DynDNS Server] %s: %w (%s)", name, ErrRFC2136NotInZone, s.zone)
+		return result
+	}
+
+	existing, err := s.lookup(name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+		return result
+	}
+
+	if len(existing) == 0 {
+		result.Success = true
+		return result
+	}
+
+	result.PreviousValue = rfc2136Values(existing)
+
+	rrSet := &miekg.ANY{Hdr: miekg.RR_Header{Name: name, Rrtype: miekg.StringToType[rrType], Class: miekg.ClassINET}}
+
+	remove := new(miekg.Msg)
+	remove.SetUpdate(s.zone)
+	remove.RRsetUsed([]miekg.RR{rrSet})
+	remove.RemoveRRset([]miekg.RR{rrSet})
+
+	err = s.exchange(remove)
+
+	var rcodeErr *rfc2136RcodeError
+	if errors.As(err, &rcodeErr) && rcodeErr.Rcode == miekg.RcodeNXRrset {
+		result.Success = true
+		return result
+	}
+
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+		return result
+	}
+
+	result.Deleted = true
+	result.Success = true
+	return result
+}
+
+// lookup queries the server for the RRset. Like the SOA query of CheckHealth it is not signed, the server has to
+// answer queries for the zone from the dyndns server.
+func (s *rfc2136Service) lookup(name string, rrType string) ([]miekg.RR, error) {
+	query := new(miekg.Msg)
+	query.SetQuestion(miekg.Fqdn(name), miekg.StringToType[rrType])
+	query.RecursionDesired = false
+
+	response, _, err := s.client.Exchange(query, s.server)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Rcode != miekg.RcodeSuccess && response.Rcode != miekg.RcodeNameError {
+		return nil, &rfc2136RcodeError{Rcode: response.Rcode}
+	}
+
+	var rrSet []miekg.RR
+	for _, rr := range response.Answer {
+		if rr.Header().Rrtype == miekg.StringToType[rrType] && strings.EqualFold(rr.Header().Name, miekg.Fqdn(name)) {
+			rrSet = append(rrSet, rr)
+		}
+	}
+
+	return rrSet, nil
+}
+
+func (s *rfc2136Service) newRR(name string, rrType string, value string, ttl uint32) (miekg.RR, error) {
+	if !miekg.IsSubDomain(s.zone, name) {
+		return nil, fmt.Errorf("[DynDNS Server] %s: %w (%s)", name, ErrRFC2136NotInZone, s.zone)
+	}
+
+	rr, err := miekg.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, rrType, value))
+	if err != nil {
+		return nil, fmt.Errorf("[DynDNS Server] invalid %s record %q: %v", rrType, value, err)
+	}
+
+	return rr, nil
+}
+
+func (s *rfc2136Service) exchange(msg *miekg.Msg) error {
+	if s.tsigName != "" {
+		msg.SetTsig(s.tsigName, s.tsigAlgo, 300, time.Now().Unix())
+	}
+
+	response, _, err := s.client.Exchange(msg, s.server)
+	if err != nil {
+		return err
+	}
+
+	if response.Rcode != miekg.RcodeSuccess {
+		return &rfc2136RcodeError{Rcode: response.Rcode}
+	}
+
+	return nil
+}
+
+// rfc2136Values joins the addresses of the A or AAAA records in rrSet with commas.
+func rfc2136Values(rrSet []miekg.RR) string {
+	var values []string
+
+	for _, rr := range rrSet {
+		switch rr := rr.(type) {
+		case *miekg.A:
+			values = append(values, rr.A.String())
+		case *miekg.AAAA:
+			values = append(values, rr.AAAA.String())
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+type rfc2136RcodeError struct {
+	Rcode int
+}
+
+func (e *rfc2136RcodeError) Error() string {
+	return fmt.Sprintf("server answered %s", miekg.RcodeToString[e.Rcode])
+}
@@ -0,0 +1,361 @@
+package dns_test
+
+import (
+	"dyndns/pkg/dns"
+	miekg "github.com/miekg/dns"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testTSIGName   = "dyndns."
+	testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LQ=="
+)
+
+// rfc2136Server is a primary name server for example.com. accepting UPDATE messages signed with the test key. It
+// checks the RRsetUsed and RRsetNotUsed prerequisites the provider sends and applies the updates to its records.
+type rfc2136Server struct {
+	mu      sync.Mutex
+	records map[string][]miekg.RR
+	stale   map[string][]miekg.RR
+	updates int
+	addr    string
+}
+
+func newRFC2136Server(t *testing.T) *rfc2136Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	srv := &rfc2136Server{records: map[string][]miekg.RR{}, addr: listener.Addr().String()}
+	started := make(chan struct{})
+
+	server := &miekg.Server{
+		Listener:          listener,
+		TsigSecret:        map[string]string{testTSIGName: testTSIGSecret},
+		Handler:           miekg.HandlerFunc(srv.serveDNS),
+		MsgAcceptFunc:     func(miekg.Header) miekg.MsgAcceptAction { return miekg.MsgAccept },
+		NotifyStartedFunc: func() { close(started) },
+	}
+
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	<-started
+
+	return srv
+}
+
+func rfc2136Key(name string, rrType uint16) string {
+	return strings.ToLower(name) + "/" + miekg.TypeToString[rrType]
+}
+
+// SetRecord replaces the RRset of name with one record, an empty value deletes it.
+func (s *rfc2136Server) SetRecord(name string, rrType string, ttl uint32, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := rfc2136Key(name, miekg.StringToType[rrType])
+
+	if value == "" {
+		delete(s.records, key)
+		return
+	}
+
+	rr, _ := miekg.NewRR(name + " " + strconv.Itoa(int(ttl)) + " IN " + rrType + " " + value)
+	s.records[key] = []miekg.RR{rr}
+}
+
+// Record returns the RRset of name as "ttl value", or "" if it does not exist.
+func (s *rfc2136Server) Record(name string, rrType string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var values []string
+
+	for _, rr := range s.records[rfc2136Key(name, miekg.StringToType[rrType])] {
+		fields := strings.Fields(rr.String())
+		values = append(values, fields[1]+" "+fields[len(fields)-1])
+	}
+
+	return strings.Join(values, ",")
+}
+
+// FreezeQueries answers queries from the current records from now on, as if another writer changed the zone
+// between the provider's query and its update.
+func (s *rfc2136Server) FreezeQueries() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stale = map[string][]miekg.RR{}
+
+	for key, rrSet := range s.records {
+		s.stale[key] = rrSet
+	}
+}
+
+// Updates returns the number of UPDATE messages received.
+func (s *rfc2136Server) Updates() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updates
+}
+
+func (s *rfc2136Server) serveDNS(w miekg.ResponseWriter, r *miekg.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := new(miekg.Msg)
+	m.SetReply(r)
+
+	if r.Opcode == miekg.OpcodeQuery {
+		records := s.records
+
+		if s.stale != nil {
+			records = s.stale
+		}
+
+		q := r.Question[0]
+
+		if q.Qtype == miekg.TypeSOA {
+			soa, _ := miekg.NewRR("example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 7200 900 1209600 60")
+			m.Answer = append(m.Answer, soa)
+		} else {
+			m.Answer = append(m.Answer, records[rfc2136Key(q.Name, q.Qtype)]...)
+		}
+
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	s.updates++
+
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.Rcode = miekg.RcodeNotAuth
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	m.SetTsig(testTSIGName, miekg.HmacSHA256, 300, time.Now().Unix())
+	m.Rcode = s.applyUpdate(r)
+	_ = w.WriteMsg(m)
+}
+
+func (s *rfc2136Server) applyUpdate(r *miekg.Msg) int {
+	for _, rr := range r.Answer {
+		_, exists := s.records[rfc2136Key(rr.Header().Name, rr.Header().Rrtype)]
+
+		switch {
+		case rr.Header().Class == miekg.ClassANY && !exists:
+			return miekg.RcodeNXRrset
+		case rr.Header().Class == miekg.ClassNONE && exists:
+			return miekg.RcodeYXRrset
+		}
+	}
+
+	for _, rr := range r.Ns {
+		key := rfc2136Key(rr.Header().Name, rr.Header().Rrtype)
+
+		switch rr.Header().Class {
+		case miekg.ClassANY:
+			delete(s.records, key)
+		case miekg.ClassINET:
+			s.records[key] = append(s.records[key], rr)
+		}
+	}
+
+	return miekg.RcodeSuccess
+}
+
+func newRFC2136Service(t *testing.T, secret string) (dns.DynDNSService, *rfc2136Server) {
+	t.Helper()
+
+	srv := newRFC2136Server(t)
+
+	service, err := dns.NewRFC2136Service(&dns.RFC2136Config{
+		Server:        srv.addr,
+		Zone:          "example.com",
+		TSIGName:      testTSIGName,
+		TSIGSecret:    secret,
+		TSIGAlgorithm: "hmac-sha256",
+		Transport:     "tcp",
+		Timeout:       5 * time.Second,
+	}, testHostname)
+
+	if err != nil {
+		t.Fatalf("NewRFC2136Service: %v", err)
+	}
+
+	return service, srv
+}
+
+func TestRFC2136Create(t *testing.T) {
+	service, srv := newRFC2136Service(t, testTSIGSecret)
+
+	result, v6Result := service.UpdateDNSRecord(testHostname, "192.0.2.1", "2001:db8::1", 0)
+
+	for _, r := range []*dns.UpdateResult{result, v6Result} {
+		if !r.Success || !r.Created || r.Updated || r.PreviousValue != "" {
+			t.Fatalf("%s result = %+v, want created", r.RRType, r)
+		}
+	}
+
+	if got := srv.Record(testHostname, "A"); got != "60 192.0.2.1" {
+		t.Fatalf("A record = %q, want 60 192.0.2.1", got)
+	}
+
+	if got := srv.Record(testHostname, "AAAA"); got != "60 2001:db8::1" {
+		t.Fatalf("AAAA record = %q, want 60 2001:db8::1", got)
+	}
+
+	// A missing RRset is created with a single RRsetNotUsed update
+	if updates := srv.Updates(); updates != 2 {
+		t.Fatalf("updates = %d, want 2", updates)
+	}
+}
+
+func TestRFC2136Update(t *testing.T) {
+	service, srv := newRFC2136Service(t, testTSIGSecret)
+	srv.SetRecord(testHostname, "A", 300, "192.0.2.1")
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Updated || result.Created || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want updated from 192.0.2.1", result)
+	}
+
+	if got := srv.Record(testHostname, "A"); got != "300 192.0.2.2" {
+		t.Fatalf("A record = %q, want 300 192.0.2.2", got)
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 300)
+
+	if !result.Success || !result.Unchanged || result.Updated || result.PreviousValue != "192.0.2.2" {
+		t.Fatalf("A result = %+v, want unchanged", result)
+	}
+
+	result, _ = service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 60)
+
+	if !result.Success || !result.Updated {
+		t.Fatalf("A result = %+v, want updated for the new TTL", result)
+	}
+
+	// The create is refused with YXRRSET and the RRset replaced with RRsetUsed, twice; the unchanged record is not
+	// written
+	if updates := srv.Updates(); updates != 4 {
+		t.Fatalf("updates = %d, want 4", updates)
+	}
+}
+
+func TestRFC2136CreateRace(t *testing.T) {
+	service, srv := newRFC2136Service(t, testTSIGSecret)
+
+	// Another writer creates the record after the provider read the zone
+	srv.FreezeQueries()
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.2", "", 0)
+
+	if !result.Success || !result.Updated || result.Created {
+		t.Fatalf("A result = %+v, want updated after YXRRSET", result)
+	}
+
+	if got := srv.Record(testHostname, "A"); got != "60 192.0.2.2" {
+		t.Fatalf("A record = %q, want 60 192.0.2.2", got)
+	}
+}
+
+func TestRFC2136InvalidKey(t *testing.T) {
+	service, srv := newRFC2136Service(t, "d3Jvbmctc2VjcmV0")
+
+	result, _ := service.UpdateDNSRecord(testHostname, "192.0.2.1", "", 0)
+
+	if result.Success || result.Error == nil || !strings.Contains(result.Error.Error(), "NOTAUTH") {
+		t.Fatalf("A result = %+v, want NOTAUTH", result)
+	}
+
+	if got := srv.Record(testHostname, "A"); got != "" {
+		t.Fatalf("A record = %q, want none", got)
+	}
+
+	if err := service.ValidateCredentials(); err == nil {
+		t.Fatal("ValidateCredentials succeeded with an invalid key")
+	}
+}
+
+func TestRFC2136ValidateCredentials(t *testing.T) {
+	service, srv := newRFC2136Service(t, testTSIGSecret)
+
+	if err := service.CheckHealth(); err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+
+	if err := service.ValidateCredentials(); err != nil {
+		t.Fatalf("ValidateCredentials: %v", err)
+	}
+
+	if updates := srv.Updates(); updates != 2 {
+		t.Fatalf("updates = %d, want a create and a delete", updates)
+	}
+}
+
+func TestRFC2136Delete(t *testing.T) {
+	service, srv := newRFC2136Service(t, testTSIGSecret)
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+	srv.SetRecord(testHostname, "AAAA", 60, "2001:db8::1")
+
+	result, v6Result := service.DeleteDNSRecord(testHostname, true, false)
+
+	if v6Result != nil {
+		t.Fatalf("AAAA result = %+v, want nil", v6Result)
+	}
+
+	if !result.Success || !result.Deleted || result.PreviousValue != "192.0.2.1" {
+		t.Fatalf("A result = %+v, want deleted", result)
+	}
+
+	if got := srv.Record(testHostname, "A"); got != "" {
+		t.Fatalf("A record = %q, want none", got)
+	}
+
+	if got := srv.Record(testHostname, "AAAA"); got != "60 2001:db8::1" {
+		t.Fatalf("AAAA record = %q, want it untouched", got)
+	}
+}
+
+func TestRFC2136DeleteMissing(t *testing.T) {
+	service, srv := newRFC2136Service(t, testTSIGSecret)
+
+	result, _ := service.DeleteDNSRecord(testHostname, true, false)
+
+	if !result.Success || result.Deleted || result.Error != nil {
+		t.Fatalf("A result = %+v, want success without deletion", result)
+	}
+
+	if updates := srv.Updates(); updates != 0 {
+		t.Fatalf("updates = %d, want 0", updates)
+	}
+
+	// Another writer deletes the record after the provider read the zone, the server answers NXRRSET
+	srv.SetRecord(testHostname, "A", 60, "192.0.2.1")
+	srv.FreezeQueries()
+	srv.SetRecord(testHostname, "A", 0, "")
+
+	result, _ = service.DeleteDNSRecord(testHostname, true, false)
+
+	if !result.Success || result.Deleted || result.Error != nil {
+		t.Fatalf("A result = %+v, want success without deletion after NXRRSET", result)
+	}
+
+	if updates := srv.Updates(); updates != 1 {
+		t.Fatalf("updates = %d, want 1", updates)
+	}
+}
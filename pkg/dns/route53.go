@@ -0,0 +1,358 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"dyndns/pkg/utils"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	Route53DefaultTTL = 60
+)
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:        "route53",
+		Description: "Amazon Route 53",
+		Options: []ProviderOption{
+			{Name: "route53-hosted-zone-id", Env: "DYNDNS_ROUTE53_HOSTED_ZONE_ID", Usage: "Route 53 hosted zone ID", Required: true},
+			{Name: "route53-access-key-id", Env: "DYNDNS_ROUTE53_ACCESS_KEY_ID", Usage: "Static AWS access key ID. Leave empty to use the shared credentials file"},
+			{Name: "route53-secret-access-key", Env: "DYNDNS_ROUTE53_SECRET_ACCESS_KEY", Usage: "Static AWS secret access key", Secret: true},
+			{Name: "route53-credentials-file", Env: "DYNDNS_ROUTE53_CREDENTIALS_FILE", Usage: "Path to a shared AWS credentials file (default ~/.aws/credentials)"},
+			{Name: "route53-profile", Env: "DYNDNS_ROUTE53_PROFILE", Usage: "Profile to use from the shared credentials file"},
+			{Name: "route53-region", Env: "DYNDNS_ROUTE53_REGION", Default: "us-east-1", Usage: "AWS region used to sign the requests"},
+			{Name: "route53-wait-timeout", Env: "DYNDNS_ROUTE53_WAIT_TIMEOUT", Default: "0", Usage: "How long a request waits for its change to become INSYNC, 0 answers once the change is accepted"},
+			{Name: "route53-endpoint", Env: "DYNDNS_ROUTE53_ENDPOINT", Usage: "Custom Route 53 API endpoint"},
+		},
+		New: func(cfg *ProviderConfig) (DynDNSService, error) {
+			waitTimeout, err := time.ParseDuration(cfg.Get("route53-wait-timeout"))
+			if err != nil {
+				return nil, fmt.Errorf("[DynDNS Server] invalid route53-wait-timeout: %v", err)
+			}
+
+			return NewRoute53Service(&Route53Config{
+				HostedZoneID:    cfg.Get("route53-hosted-zone-id"),
+				AccessKeyID:     cfg.Get("route53-access-key-id"),
+				SecretAccessKey: cfg.Get("route53-secret-access-key"),
+				CredentialsFile: cfg.Get("route53-credentials-file"),
+				Profile:         cfg.Get("route53-profile"),
+				Region:          cfg.Get("route53-region"),
+				WaitTimeout:     waitTimeout,
+				Endpoint:        cfg.Get("route53-endpoint"),
+			}, cfg.DomainName)
+		},
+		CredentialFiles: func(cfg *ProviderConfig) []string {
+			if cfg.Get("route53-access-key-id") != "" || cfg.Get("route53-secret-access-key") != "" {
+				return nil
+			}
+
+			credentialsFile := cfg.Get("route53-credentials-file")
+			if credentialsFile == "" {
+				credentialsFile = utils.OsEnv("AWS_SHARED_CREDENTIALS_FILE", config.DefaultSharedCredentialsFilename())
+			}
+			return []string{credentialsFile, utils.OsEnv("AWS_CONFIG_FILE", config.DefaultSharedConfigFilename())}
+		},
+	})
+}
+
+type Route53Config struct {
+	HostedZoneID    string
+	AccessKeyID     string
+	SecretAccessKey string
+	CredentialsFile string
+	Profile         string
+	Region          string
+	WaitTimeout     time.Duration
+	Endpoint        string
+}
+
+type route53Service struct {
+	client       *route53.Client
+	hostedZoneID string
+	waitTimeout  time.Duration
+	domainName   string
+}
+
+func NewRoute53Service(cfg *Route53Config, domainName string) (DynDNSService, error) {
+
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithRegion(cfg.Region),
+	}
+
+	switch {
+	case cfg.AccessKeyID != "" || cfg.SecretAccessKey != "":
+		if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+			return nil, fmt.Errorf("[DynDNS Server] route53 static credentials require both an access key ID and a secret access key")
+		}
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		))
+	case cfg.CredentialsFile != "":
+		loadOptions = append(loadOptions, config.WithSharedCredentialsFiles([]string{cfg.CredentialsFile}))
+	}
+
+	if cfg.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(cfg.Profile))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(globalContext, loadOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("[DynDNS Server] failed to load AWS configuration: %v", err)
+	}
+
+	client := route53.NewFromConfig(awsConfig, func(o *route53.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	return &route53Service{
+		client:       client,
+		hostedZoneID: strings.TrimPrefix(cfg.HostedZoneID, "/hostedzone/"),
+		waitTimeout:  cfg.WaitTimeout,
+		domainName:   domainName,
+	}, nil
+}
+
+func (s *route53Service) UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult) {
+
+	if ipAddress == "" && ipv6Address == "" {
+		return nil, nil
+	}
+
+	var result, v6Result *UpdateResult
+
+	if ipAddress != "" {
+		result = s.updateRecord(hostname, types.RRTypeA, ipAddress, ttl)
+	}
+
+	if ipv6Address != "" {
+		v6Result = s.updateRecord(hostname, types.RRTypeAaaa, ipv6Address, ttl)
+	}
+
+	return result, v6Result
+}
+
+func (s *route53Service) DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult) {
+
+	var result, v6Result *UpdateResult
+
+	if v4 {
+		result = s.removeRecord(hostname, types.RRTypeA)
+	}
+
+	if v6 {
+		v6Result = s.removeRecord(hostname, types.RRTypeAaaa)
+	}
+
+	return result, v6Result
+}
+
+func (s *route53Service) CheckHealth() error {
+	_, err := s.client.GetHostedZone(globalContext, &route53.GetHostedZoneInput{Id: aws.String(s.hostedZoneID)})
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to get hosted zone: %v", err)
+	}
+
+	return nil
+}
+
+func (s *route53Service) ValidateCredentials() error {
+
+	// Read Test
+	if err := s.CheckHealth(); err != nil {
+		return err
+	}
+
+	testRecord := &types.ResourceRecordSet{
+		Name:            aws.String(fmt.Sprintf("%s.%d.%s", DNSCredentialValidationRecord, time.Now().Unix(), s.domainName)),
+		Type:            types.RRTypeA,
+		TTL:             aws.Int64(300),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(DNSCredentialValidationIP)}},
+	}
+
+	// Write Test
+	if _, err := s.change(types.ChangeActionCreate, testRecord); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to create resource record set: %v", err)
+	}
+
+	// Cleanup
+	if _, err := s.change(types.ChangeActionDelete, testRecord); err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+	}
+
+	return nil
+}
+
+// updateRecord UPSERTs the record and, with a wait timeout, waits until Route 53 reports the change as INSYNC. A
+// lookup beforehand skips the write if nothing changed and decides whether the result is reported as created or
+// updated.
+func (s *route53Service) updateRecord(name string, rrType types.RRType, value string, ttl int) *UpdateResult {
+	if ttl == 0 {
+		ttl = Route53DefaultTTL
+	}
+
+	result := &UpdateResult{
+		Name:   name,
+		RRType: string(rrType),
+		Value:  value,
+		TTL:    ttl,
+	}
+
+	existing, err := s.findRecord(name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+		return result
+	}
+
+	if existing != nil {
+		var values []string
+		for _, record := range existing.ResourceRecords {
+			values = append(values, aws.ToString(record.Value))
+		}
+		result.PreviousValue = strings.Join(values, ",")
+
+		if aws.ToInt64(existing.TTL) == int64(ttl) && result.PreviousValue == value {
+			result.Unchanged = true
+			result.Success = true
+			return result
+		}
+	}
+
+	changeInfo, err := s.change(types.ChangeActionUpsert, &types.ResourceRecordSet{
+		Name:            aws.String(name),
+		Type:            rrType,
+		TTL:             aws.Int64(int64(ttl)),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(value)}},
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to upsert resource record set: %v", err)
+		return result
+	}
+
+	result.ChangeID = aws.ToString(changeInfo.Id)
+
+	if err := s.wait(changeInfo); err != nil {
+		result.Error = err
+		return result
+	}
+
+	if existing != nil {
+		result.Updated = true
+	} else {
+		result.Created = true
+	}
+	result.Success = true
+
+	return result
+}
+
+// removeRecord DELETEs the record set exactly as it was listed, which Route 53 requires.
+func (s *route53Service) removeRecord(name string, rrType types.RRType) *UpdateResult {
+	result := &UpdateResult{
+		Name:   name,
+		RRType: string(rrType),
+	}
+
+	existing, err := s.findRecord(name, rrType)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to get resource record set: %v", err)
+		return result
+	}
+
+	if existing == nil {
+		result.Success = true
+		return result
+	}
+
+	var values []string
+	for _, record := range existing.ResourceRecords {
+		values = append(values, aws.ToString(record.Value))
+	}
+	result.PreviousValue = strings.Join(values, ",")
+
+	changeInfo, err := s.change(types.ChangeActionDelete, existing)
+	if err != nil {
+		result.Error = fmt.Errorf("[DynDNS Server] failed to delete resource record set: %v", err)
+		return result
+	}
+
+	result.ChangeID = aws.ToString(changeInfo.Id)
+
+	if err := s.wait(changeInfo); err != nil {
+		result.Error = err
+		return result
+	}
+
+	result.Deleted = true
+	result.Success = true
+
+	return result
+}
+
+// wait blocks until the change is INSYNC or the wait timeout expires.
+func (s *route53Service) wait(changeInfo *types.ChangeInfo) error {
+	if s.waitTimeout <= 0 || changeInfo.Status == types.ChangeStatusInsync {
+		return nil
+	}
+
+	waiter := route53.NewResourceRecordSetsChangedWaiter(s.client, func(o *route53.ResourceRecordSetsChangedWaiterOptions) {
+		o.MinDelay = 2 * time.Second
+		o.MaxDelay = 15 * time.Second
+	})
+
+	if err := waiter.Wait(globalContext, &route53.GetChangeInput{Id: changeInfo.Id}, s.waitTimeout); err != nil {
+		return fmt.Errorf("[DynDNS Server] change %s did not become INSYNC: %v", aws.ToString(changeInfo.Id), err)
+	}
+
+	return nil
+}
+
+func (s *route53Service) findRecord(name string, rrType types.RRType) (*types.ResourceRecordSet, error) {
+	output, err := s.client.ListResourceRecordSets(globalContext, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(s.hostedZoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: rrType,
+		MaxItems:        aws.Int32(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rrSet := range output.ResourceRecordSets {
+		if strings.EqualFold(route53Fqdn(aws.ToString(rrSet.Name)), route53Fqdn(name)) && rrSet.Type == rrType {
+			return &rrSet, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *route53Service) change(action types.ChangeAction, rrSet *types.ResourceRecordSet) (*types.ChangeInfo, error) {
+	output, err := s.client.ChangeResourceRecordSets(globalContext, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(s.hostedZoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Comment: aws.String("dyndns-server"),
+			Changes: []types.Change{{Action: action, ResourceRecordSet: rrSet}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.ChangeInfo, nil
+}
+
+func route53Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
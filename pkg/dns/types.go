@@ -1,10 +1,20 @@
 package dns
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+)
 
 type DynDNSService interface {
-	UpdateDNSRecord(ipAddress string, ipv6Address string) (*UpdateResult, *UpdateResult)
+	// UpdateDNSRecord writes the A and/or AAAA record of hostname. A ttl of 0 selects the default of the provider.
+	UpdateDNSRecord(hostname string, ipAddress string, ipv6Address string, ttl int) (*UpdateResult, *UpdateResult)
+	// DeleteDNSRecord removes the A (v4) and/or AAAA (v6) record of hostname. The result of a family that was not
+	// requested is nil. Deleting a record that does not exist succeeds without setting Deleted.
+	DeleteDNSRecord(hostname string, v4 bool, v6 bool) (*UpdateResult, *UpdateResult)
+	// ValidateCredentials checks that the records can be written, by creating and deleting a test record.
 	ValidateCredentials() error
+	// CheckHealth checks with a cheap read that the backend is reachable and still accepts the credentials.
+	CheckHealth() error
 }
 
 type UpdateResult struct {
@@ -13,8 +23,16 @@ type UpdateResult struct {
 	Success bool   `json:"success"`
 	Created bool   `json:"created"`
 	Updated bool   `json:"updated"`
-	Value   string `json:"value"`
-	Error   error  `json:"-"`
+	Deleted bool   `json:"deleted"`
+	// Unchanged is set instead of Created or Updated if the record already had the requested value and TTL.
+	Unchanged bool   `json:"unchanged"`
+	Value     string `json:"value"`
+	// PreviousValue is the value the record had before the update, empty if it did not exist.
+	PreviousValue string `json:"previous_value,omitempty"`
+	TTL           int    `json:"ttl,omitempty"`
+	// ChangeID identifies the provider side change that applied the record, if the provider has one.
+	ChangeID string `json:"change_id,omitempty"`
+	Error    error  `json:"-"`
 }
 
 func (u UpdateResult) MarshalJSON() ([]byte, error) {
@@ -32,3 +50,62 @@ func (u UpdateResult) MarshalJSON() ([]byte, error) {
 		Alias: (*Alias)(&u),
 	})
 }
+
+func (u *UpdateResult) UnmarshalJSON(data []byte) error {
+	type Alias UpdateResult
+	aux := &struct {
+		*Alias
+		Error string `json:"error,omitempty"`
+	}{
+		Alias: (*Alias)(u),
+	}
+
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	if aux.Error != "" {
+		u.Error = errors.New(aux.Error)
+	}
+
+	return nil
+}
+
+// Provider describes a DNS backend that can be selected with the --provider flag.
+type Provider struct {
+	Name        string
+	Description string
+	Options     []ProviderOption
+	New         func(cfg *ProviderConfig) (DynDNSService, error)
+	// CredentialFiles lists the files the service reads its credentials from, so a reload notices credentials
+	// rotated in place. Nil if the credentials are only passed as options.
+	CredentialFiles func(cfg *ProviderConfig) []string
+	// Stateful providers keep their records or listeners in the service itself. A reload cannot replace the service
+	// without losing them, so their options only change on restart.
+	Stateful bool
+}
+
+// ProviderOption is a single configuration value of a provider. Name is used as the flag name, Env as the
+// environment variable providing its default value. The value of a Secret option may also be read from the file named
+// by Env with a _FILE suffix.
+type ProviderOption struct {
+	Name     string
+	Env      string
+	Default  string
+	Usage    string
+	Required bool
+	Secret   bool
+}
+
+// ProviderConfig is the config block handed to a provider when the service is created.
+type ProviderConfig struct {
+	DomainName string
+	Options    map[string]string
+}
+
+func (p *ProviderConfig) Get(name string) string {
+	if p.Options == nil {
+		return ""
+	}
+	return p.Options[name]
+}
@@ -0,0 +1,355 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// bucketEntries maps the big-endian ID of an entry to its JSON, so a cursor walks the entries in order of arrival.
+	bucketEntries = []byte("entries")
+	// bucketHostnames holds one bucket per lower-case hostname with the IDs of its entries as keys.
+	bucketHostnames = []byte("hostnames")
+)
+
+const (
+	// pruneInterval is how often entries older than the retention are removed.
+	pruneInterval = time.Hour
+	// pruneBatch is how many entries one transaction of Prune removes at most.
+	pruneBatch = 1000
+)
+
+// Store keeps the history in a bbolt file. It is safe for concurrent use, concurrent Adds share a transaction.
+type Store struct {
+	db        *bbolt.DB
+	retention time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// Open opens or creates the history file at path. With a retention above 0 entries older than it are removed at
+// start and then every hour. The file is locked, a second server on the same file fails to open it.
+func Open(path string, retention time.Duration) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+
+	if err != nil {
+		return nil, fmt.Errorf("[DynDNS Server] failed to open history %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketEntries, bucketHostnames} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("[DynDNS Server] failed to initialize history %s: %v", path, err)
+	}
+
+	s := &Store{
+		db:        db,
+		retention: retention,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go s.pruneLoop()
+
+	return s, nil
+}
+
+// Add stores entry under the next ID. A zero Time is set to now when the ID is assigned, so the entries are in order
+// of time as well, which Query and Prune rely on to stop early.
+func (s *Store) Add(entry Entry) error {
+	now := entry.Time.IsZero()
+
+	err := s.db.Batch(func(tx *bbolt.Tx) error {
+		entries := tx.Bucket(bucketEntries)
+
+		id, err := entries.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		entry.ID = id
+
+		if now {
+			entry.Time = time.Now()
+		}
+
+		entry.Time = entry.Time.UTC()
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if err := entries.Put(idKey(id), data); err != nil {
+			return err
+		}
+
+		if entry.Hostname == "" {
+			return nil
+		}
+
+		index, err := tx.Bucket(bucketHostnames).CreateBucketIfNotExists([]byte(strings.ToLower(entry.Hostname)))
+		if err != nil {
+			return err
+		}
+
+		return index.Put(idKey(id), []byte{})
+	})
+
+	if err != nil {
+		return fmt.Errorf("[DynDNS Server] failed to add history entry: %v", err)
+	}
+
+	return nil
+}
+
+// Query returns a page of the entries selected by q, newest first.
+func (s *Store) Query(q Query) (*Page, error) {
+	limit := q.Limit
+
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	before := uint64(math.MaxUint64)
+
+	if q.Cursor != "" {
+		var err error
+		before, err = strconv.ParseUint(q.Cursor, 10, 64)
+
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	page := &Page{Entries: []Entry{}}
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		entries := tx.Bucket(bucketEntries)
+		cursors := queryCursors(tx, q)
+		keys := make([][]byte, len(cursors))
+
+		// Seek finds the first key at or after before, the page starts with the one in front of it
+		for i, cursor := range cursors {
+			if key, _ := cursor.Seek(idKey(before)); key == nil {
+				keys[i], _ = cursor.Last()
+			} else {
+				keys[i], _ = cursor.Prev()
+			}
+		}
+
+		for {
+			// The cursors are merged by always taking the newest of their keys
+			next := -1
+
+			for i, key := range keys {
+				if key != nil && (next < 0 || bytes.Compare(key, keys[next]) > 0) {
+					next = i
+				}
+			}
+
+			if next < 0 {
+				return nil
+			}
+
+			key := keys[next]
+			keys[next], _ = cursors[next].Prev()
+
+			data := entries.Get(key)
+
+			if data == nil {
+				continue
+			}
+
+			var entry Entry
+
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+
+			if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+				return nil
+			}
+
+			if len(page.Entries) == limit {
+				page.Next = strconv.FormatUint(page.Entries[limit-1].ID, 10)
+				return nil
+			}
+
+			page.Entries = append(page.Entries, entry)
+		}
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("[DynDNS Server] failed to query history: %v", err)
+	}
+
+	return page, nil
+}
+
+// queryCursors returns the cursors over the IDs selected by q: the index of each selected hostname, or all entries if
+// q selects no hostname.
+func queryCursors(tx *bbolt.Tx, q Query) []*bbolt.Cursor {
+	if q.Hostname == "" && q.MatchHostname == nil {
+		return []*bbolt.Cursor{tx.Bucket(bucketEntries).Cursor()}
+	}
+
+	hostnames := tx.Bucket(bucketHostnames)
+	var names [][]byte
+
+	if q.Hostname != "" {
+		names = append(names, []byte(strings.ToLower(q.Hostname)))
+	} else {
+		_ = hostnames.ForEach(func(name []byte, value []byte) error {
+			if value == nil { // Nested buckets have no value
+				names = append(names, name)
+			}
+			return nil
+		})
+	}
+
+	var cursors []*bbolt.Cursor
+
+	for _, name := range names {
+		if q.MatchHostname != nil && !q.MatchHostname(string(name)) {
+			continue
+		}
+
+		if index := hostnames.Bucket(name); index != nil {
+			cursors = append(cursors, index.Cursor())
+		}
+	}
+
+	return cursors
+}
+
+// Prune removes the entries older than before and returns how many it removed.
+func (s *Store) Prune(before time.Time) (int, error) {
+	removed := 0
+
+	for {
+		count := 0
+
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			entries := tx.Bucket(bucketEntries)
+			hostnames := tx.Bucket(bucketHostnames)
+
+			var expired []Entry
+
+			cursor := entries.Cursor()
+
+			for key, data := cursor.First(); key != nil && len(expired) < pruneBatch; key, data = cursor.Next() {
+				var entry Entry
+
+				if err := json.Unmarshal(data, &entry); err != nil {
+					return err
+				}
+
+				if !entry.Time.Before(before) {
+					break
+				}
+
+				expired = append(expired, entry)
+			}
+
+			// Deleting behind a cursor makes it skip keys, so the expired entries are collected first
+			for _, entry := range expired {
+				if err := entries.Delete(idKey(entry.ID)); err != nil {
+					return err
+				}
+
+				if entry.Hostname == "" {
+					continue
+				}
+
+				name := []byte(strings.ToLower(entry.Hostname))
+
+				if index := hostnames.Bucket(name); index != nil {
+					if err := index.Delete(idKey(entry.ID)); err != nil {
+						return err
+					}
+
+					if key, _ := index.Cursor().First(); key == nil {
+						if err := hostnames.DeleteBucket(name); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			count = len(expired)
+			return nil
+		})
+
+		if err != nil {
+			return removed, fmt.Errorf("[DynDNS Server] failed to prune history: %v", err)
+		}
+
+		removed += count
+
+		if count < pruneBatch {
+			return removed, nil
+		}
+	}
+}
+
+// Close stops the pruning and closes the file.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *Store) pruneLoop() {
+	defer close(s.done)
+
+	if s.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.Prune(time.Now().Add(-s.retention))
+
+		if err != nil {
+			slog.Warn("Failed to prune history", "error", err)
+		} else if removed > 0 {
+			slog.Debug("Pruned history", "removed", removed)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func idKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,241 @@
+package history_test
+
+import (
+	"dyndns/pkg/history"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T) *history.Store {
+	t.Helper()
+
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"), 0)
+
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	t.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+func addEntries(t *testing.T, store *history.Store, entries ...history.Entry) {
+	t.Helper()
+
+	for _, entry := range entries {
+		if err := store.Add(entry); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+}
+
+func query(t *testing.T, store *history.Store, q history.Query) *history.Page {
+	t.Helper()
+
+	page, err := store.Query(q)
+
+	if err != nil {
+		t.Fatalf("Query(%+v): %v", q, err)
+	}
+
+	return page
+}
+
+// values returns the values of the entries of page, e.g. "3,2,1".
+func values(page *history.Page) string {
+	var values []string
+
+	for _, entry := range page.Entries {
+		values = append(values, entry.Value)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func TestQueryPages(t *testing.T) {
+	store := openStore(t)
+
+	for _, value := range []string{"1", "2", "3", "4", "5"} {
+		addEntries(t, store, history.Entry{Hostname: "home.example.com.", Value: value})
+	}
+
+	want := []struct {
+		values string
+		next   string
+	}{
+		{"5,4", "4"},
+		{"3,2", "2"},
+		{"1", ""},
+	}
+
+	cursor := ""
+
+	for i, w := range want {
+		page := query(t, store, history.Query{Cursor: cursor, Limit: 2})
+
+		if values(page) != w.values || page.Next != w.next {
+			t.Fatalf("page %d = %s next %q, want %s next %q", i+1, values(page), page.Next, w.values, w.next)
+		}
+
+		cursor = page.Next
+	}
+
+	if page := query(t, store, history.Query{}); values(page) != "5,4,3,2,1" || page.Next != "" {
+		t.Fatalf("default page = %s next %q, want all entries", values(page), page.Next)
+	}
+}
+
+func TestQueryInvalidCursor(t *testing.T) {
+	store := openStore(t)
+
+	if _, err := store.Query(history.Query{Cursor: "abc"}); !errors.Is(err, history.ErrInvalidCursor) {
+		t.Fatalf("error = %v, want %v", err, history.ErrInvalidCursor)
+	}
+}
+
+func TestQueryHostname(t *testing.T) {
+	store := openStore(t)
+
+	addEntries(t, store,
+		history.Entry{Hostname: "home.example.com.", Value: "1"},
+		history.Entry{Hostname: "office.example.com.", Value: "2"},
+		history.Entry{Hostname: "Home.Example.com.", Value: "3"},
+	)
+
+	if page := query(t, store, history.Query{Hostname: "HOME.example.com."}); values(page) != "3,1" {
+		t.Fatalf("entries = %s, want 3,1", values(page))
+	}
+
+	if page := query(t, store, history.Query{Hostname: "cabin.example.com."}); len(page.Entries) != 0 {
+		t.Fatalf("entries = %s, want none", values(page))
+	}
+}
+
+func TestQueryMatchHostname(t *testing.T) {
+	store := openStore(t)
+
+	for i, hostname := range []string{"a", "b", "c", "a", "", "c", "b", "a"} {
+		if hostname != "" {
+			hostname += ".example.com."
+		}
+
+		addEntries(t, store, history.Entry{Hostname: hostname, Value: string(rune('1' + i))})
+	}
+
+	match := func(hostname string) bool {
+		return hostname == "a.example.com." || hostname == "c.example.com."
+	}
+
+	// The indexes of both hostnames are merged into one page order
+	page := query(t, store, history.Query{MatchHostname: match, Limit: 3})
+
+	if values(page) != "8,6,4" || page.Next != "4" {
+		t.Fatalf("page 1 = %s next %q, want 8,6,4 next 4", values(page), page.Next)
+	}
+
+	page = query(t, store, history.Query{MatchHostname: match, Limit: 3, Cursor: page.Next})
+
+	if values(page) != "3,1" || page.Next != "" {
+		t.Fatalf("page 2 = %s next %q, want 3,1", values(page), page.Next)
+	}
+
+	if page := query(t, store, history.Query{MatchHostname: match, Hostname: "b.example.com."}); len(page.Entries) != 0 {
+		t.Fatalf("entries = %s, want none for a hostname that does not match", values(page))
+	}
+}
+
+func TestQuerySince(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	for i, value := range []string{"1", "2", "3", "4"} {
+		addEntries(t, store, history.Entry{Hostname: "home.example.com.", Value: value, Time: start.Add(time.Duration(i) * time.Hour)})
+	}
+
+	since := start.Add(90 * time.Minute)
+
+	if page := query(t, store, history.Query{Since: since}); values(page) != "4,3" {
+		t.Fatalf("entries = %s, want 4,3", values(page))
+	}
+
+	if page := query(t, store, history.Query{Since: since, Hostname: "home.example.com."}); values(page) != "4,3" {
+		t.Fatalf("entries of home = %s, want 4,3", values(page))
+	}
+}
+
+func TestAddOrdersTimes(t *testing.T) {
+	store := openStore(t)
+	var wg sync.WaitGroup
+
+	// Concurrent Adds share transactions, the time must still grow with the ID
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := store.Add(history.Entry{Hostname: "home.example.com."}); err != nil {
+				t.Errorf("Add: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	page := query(t, store, history.Query{Limit: history.MaxLimit})
+
+	if len(page.Entries) != 50 {
+		t.Fatalf("entries = %d, want 50", len(page.Entries))
+	}
+
+	for i := 1; i < len(page.Entries); i++ {
+		if page.Entries[i].Time.After(page.Entries[i-1].Time) {
+			t.Fatalf("entry %d at %v is newer than entry %d at %v", page.Entries[i].ID, page.Entries[i].Time, page.Entries[i-1].ID, page.Entries[i-1].Time)
+		}
+	}
+
+	oldest := page.Entries[len(page.Entries)-1].Time
+
+	if page := query(t, store, history.Query{Since: oldest}); len(page.Entries) != 50 {
+		t.Fatalf("entries since the oldest = %d, want 50", len(page.Entries))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := openStore(t)
+	now := time.Now().UTC()
+
+	addEntries(t, store,
+		history.Entry{Hostname: "home.example.com.", Value: "1", Time: now.Add(-3 * time.Hour)},
+		history.Entry{Hostname: "office.example.com.", Value: "2", Time: now.Add(-2 * time.Hour)},
+		history.Entry{Value: "3", Time: now.Add(-2 * time.Hour)},
+		history.Entry{Hostname: "home.example.com.", Value: "4", Time: now},
+	)
+
+	removed, err := store.Prune(now.Add(-time.Hour))
+
+	if err != nil || removed != 3 {
+		t.Fatalf("Prune = %d, %v, want 3 removed", removed, err)
+	}
+
+	if page := query(t, store, history.Query{}); values(page) != "4" {
+		t.Fatalf("entries = %s, want 4", values(page))
+	}
+
+	if page := query(t, store, history.Query{Hostname: "office.example.com."}); len(page.Entries) != 0 {
+		t.Fatalf("entries of office = %s, want none", values(page))
+	}
+
+	if page := query(t, store, history.Query{MatchHostname: func(string) bool { return true }}); values(page) != "4" {
+		t.Fatalf("entries of all hostnames = %s, want 4", values(page))
+	}
+
+	if removed, err := store.Prune(now.Add(-time.Hour)); err != nil || removed != 0 {
+		t.Fatalf("second Prune = %d, %v, want nothing removed", removed, err)
+	}
+}
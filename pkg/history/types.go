@@ -0,0 +1,57 @@
+package history
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	// DefaultLimit is the page size of a Query without a limit, MaxLimit the largest page a Query may ask for.
+	DefaultLimit = 50
+	MaxLimit     = 1000
+)
+
+// Entry is one accepted or rejected change of a record. Requests rejected before their hostname was resolved keep
+// the hostname as the client sent it, RRType is empty if the request was rejected for both families.
+type Entry struct {
+	ID            uint64    `json:"id"`
+	Time          time.Time `json:"time"`
+	Hostname      string    `json:"hostname"`
+	RRType        string    `json:"rr_type,omitempty"`
+	PreviousValue string    `json:"previous_value,omitempty"`
+	Value         string    `json:"value,omitempty"`
+	TTL           int       `json:"ttl,omitempty"`
+	ClientIP      string    `json:"client_ip"`
+	User          string    `json:"user,omitempty"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Route         string    `json:"route"`
+	// Outcome is created, updated, unchanged, deleted, error or rejected. Reason is set for rejected entries.
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Query selects entries, newest first.
+type Query struct {
+	// Hostname limits the entries to one FQDN, empty selects all.
+	Hostname string
+	// Since drops entries older than it.
+	Since time.Time
+	// Cursor continues after the last entry of a previous page, see Page.Next.
+	Cursor string
+	// Limit is the page size, 0 selects DefaultLimit.
+	Limit int
+	// MatchHostname limits the entries to the lower-case hostnames it returns true for, e.g. those the caller may
+	// see. Only the index of these hostnames is read, so entries without a hostname are dropped. Nil keeps all.
+	MatchHostname func(hostname string) bool
+}
+
+// Page is the result of a Query. Next is the cursor of the following page, empty on the last one.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Next    string  `json:"next,omitempty"`
+}
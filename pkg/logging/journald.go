@@ -0,0 +1,114 @@
+//go:build linux
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// JournalSocket is where systemd-journald accepts native protocol datagrams.
+const JournalSocket = "/run/systemd/journal/socket"
+
+type journalSink struct {
+	conn net.Conn
+	tag  string
+}
+
+func newJournalSink(tag string) (sink, error) {
+	conn, err := net.Dial("unixgram", JournalSocket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &journalSink{conn: conn, tag: tag}, nil
+}
+
+// write turns the JSON record into journal fields: msg becomes MESSAGE, every other top-level key an upper-case field
+// of the same name. Nested groups are kept as JSON.
+func (s *journalSink) write(level slog.Level, line []byte) error {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+
+	appendJournalField(&payload, "PRIORITY", strconv.Itoa(journalPriority(level)))
+	appendJournalField(&payload, "SYSLOG_IDENTIFIER", s.tag)
+
+	for key, raw := range fields {
+		var value string
+
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw) // numbers, booleans and groups
+		}
+
+		switch key {
+		case slog.LevelKey:
+			continue
+		case slog.MessageKey:
+			key = "MESSAGE"
+		default:
+			key = journalFieldName(key)
+		}
+
+		appendJournalField(&payload, key, value)
+	}
+
+	_, err := s.conn.Write(payload.Bytes())
+
+	return err
+}
+
+func (s *journalSink) Close() error {
+	return s.conn.Close()
+}
+
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+
+	return 7
+}
+
+// journalFieldName maps a slog key to the journal field alphabet of upper-case letters, digits and underscores. Keys
+// must not start with an underscore, which is reserved for trusted fields.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+
+	return "DYNDNS_" + strings.TrimLeft(name, "_")
+}
+
+// appendJournalField encodes a field in the native protocol. Values with a newline use the length-prefixed form.
+func appendJournalField(payload *bytes.Buffer, key string, value string) {
+	if !strings.Contains(value, "\n") {
+		payload.WriteString(key + "=" + value + "\n")
+		return
+	}
+
+	payload.WriteString(key + "\n")
+	_ = binary.Write(payload, binary.LittleEndian, uint64(len(value)))
+	payload.WriteString(value + "\n")
+}
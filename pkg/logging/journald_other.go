@@ -0,0 +1,9 @@
+//go:build !linux
+
+package logging
+
+import "fmt"
+
+func newJournalSink(tag string) (sink, error) {
+	return nil, fmt.Errorf("%w: %s", ErrSinkUnsupported, SinkJournald)
+}
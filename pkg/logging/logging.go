@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// level is shared by all handlers, so SetLevel takes effect without replacing the logger.
+var level = new(slog.LevelVar)
+
+// Setup replaces the default slog logger, which the standard log package writes through as well. The returned closer
+// releases the sink.
+func Setup(opts Options) (io.Closer, error) {
+	if err := SetLevel(opts.Level); err != nil {
+		return nil, err
+	}
+
+	format := strings.ToLower(opts.Format)
+
+	if format == "" {
+		format = FormatText
+	}
+
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("%w %q: use %s or %s", ErrUnknownFormat, opts.Format, FormatText, FormatJSON)
+	}
+
+	var handler slog.Handler
+	var closer io.Closer = io.NopCloser(nil)
+
+	switch strings.ToLower(opts.Sink) {
+	case "", SinkStderr:
+		handler = newFormatHandler(format, os.Stderr, false)
+	case SinkStdout:
+		handler = newFormatHandler(format, os.Stdout, false)
+	case SinkSyslog:
+		s, err := newSyslogSink(opts.Tag)
+		if err != nil {
+			return nil, err
+		}
+		handler, closer = newSinkHandler(format, s), s
+	case SinkJournald:
+		s, err := newJournalSink(opts.Tag)
+		if err != nil {
+			return nil, err
+		}
+		// The journal splits the JSON object into its own fields, so it always gets JSON
+		handler, closer = newSinkHandler(FormatJSON, s), s
+	default:
+		return nil, fmt.Errorf("%w %q: use %s, %s, %s or %s", ErrUnknownSink, opts.Sink, SinkStderr, SinkStdout, SinkSyslog, SinkJournald)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return closer, nil
+}
+
+// SetLevel changes the minimum level of the logger set up by Setup. An empty name selects info.
+func SetLevel(name string) error {
+	parsed, err := ParseLevel(name)
+
+	if err != nil {
+		return err
+	}
+
+	level.Set(parsed)
+
+	return nil
+}
+
+func ParseLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+
+	var parsed slog.Level
+
+	if err := parsed.UnmarshalText([]byte(name)); err != nil {
+		return parsed, fmt.Errorf("invalid log level %q: use debug, info, warn or error", name)
+	}
+
+	return parsed, nil
+}
+
+// Fatal logs msg at error level and exits, the slog counterpart of log.Fatal.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func newFormatHandler(format string, w io.Writer, omitTime bool) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+
+	if omitTime {
+		// syslog and the journal timestamp the records themselves
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.NewTextHandler(w, opts)
+}
+
+// sinkHandler formats each record with a text or JSON handler into a buffer and hands the line to a sink.
+type sinkHandler struct {
+	mu    *sync.Mutex
+	buf   *bytes.Buffer
+	inner slog.Handler
+	sink  sink
+}
+
+func newSinkHandler(format string, s sink) *sinkHandler {
+	buf := &bytes.Buffer{}
+
+	return &sinkHandler{
+		mu:    &sync.Mutex{},
+		buf:   buf,
+		inner: newFormatHandler(format, buf, true),
+		sink:  s,
+	}
+}
+
+func (h *sinkHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.inner.Enabled(ctx, l)
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf.Reset()
+
+	if err := h.inner.Handle(ctx, r); err != nil {
+		return err
+	}
+
+	return h.sink.write(r.Level, bytes.TrimRight(h.buf.Bytes(), "\n"))
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{mu: h.mu, buf: h.buf, inner: h.inner.WithAttrs(attrs), sink: h.sink}
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return &sinkHandler{mu: h.mu, buf: h.buf, inner: h.inner.WithGroup(name), sink: h.sink}
+}
@@ -0,0 +1,40 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"log/slog"
+	"log/syslog"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// newSyslogSink connects to the local syslog daemon.
+func newSyslogSink(tag string) (sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) write(level slog.Level, line []byte) error {
+	switch {
+	case level >= slog.LevelError:
+		return s.w.Err(string(line))
+	case level >= slog.LevelWarn:
+		return s.w.Warning(string(line))
+	case level >= slog.LevelInfo:
+		return s.w.Info(string(line))
+	}
+
+	return s.w.Debug(string(line))
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package logging
+
+import "fmt"
+
+func newSyslogSink(tag string) (sink, error) {
+	return nil, fmt.Errorf("%w: %s", ErrSinkUnsupported, SinkSyslog)
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+)
+
+var (
+	ErrUnknownFormat   = errors.New("unknown log format")
+	ErrUnknownSink     = errors.New("unknown log sink")
+	ErrSinkUnsupported = errors.New("log sink is not supported on this platform")
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	SinkStderr   = "stderr"
+	SinkStdout   = "stdout"
+	SinkSyslog   = "syslog"
+	SinkJournald = "journald"
+)
+
+// Options selects how and where log records are written.
+type Options struct {
+	Format string
+	Level  string
+	Sink   string
+	// Tag identifies the program in syslog and the journal.
+	Tag string
+}
+
+// sink receives every record as a single formatted line. Syslog and journald take the priority from the level.
+type sink interface {
+	write(level slog.Level, line []byte) error
+	Close() error
+}
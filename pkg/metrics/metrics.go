@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of a record write, used as the outcome label of dyndns_record_updates_total.
+const (
+	OutcomeCreated   = "created"
+	OutcomeUpdated   = "updated"
+	OutcomeUnchanged = "unchanged"
+	OutcomeDeleted   = "deleted"
+	OutcomeError     = "error"
+)
+
+var (
+	recordUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dyndns",
+		Name:      "record_updates_total",
+		Help:      "Record writes requested by clients, by route, record type and outcome.",
+	}, []string{"route", "rr_type", "outcome"})
+
+	validationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dyndns",
+		Name:      "validation_errors_total",
+		Help:      "Requests or records rejected before reaching the DNS provider, by route and reason.",
+	}, []string{"route", "reason"})
+
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dyndns",
+		Name:      "auth_failures_total",
+		Help:      "Requests with wrong credentials, by route.",
+	}, []string{"route"})
+
+	apiCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "dyndns",
+		Name:      "provider_api_call_duration_seconds",
+		Help:      "Latency of the calls to the DNS provider API, by provider, operation and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "operation", "status"})
+
+	recordLastUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dyndns",
+		Name:      "record_last_update_timestamp_seconds",
+		Help:      "Unix time the record was last created or changed by this server.",
+	}, []string{"hostname", "rr_type"})
+
+	recordInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dyndns",
+		Name:      "record_info",
+		Help:      "Current value of the record as last written or confirmed by this server, always 1.",
+	}, []string{"hostname", "rr_type", "value"})
+
+	// recordMu keeps concurrent writes of one record from leaving two values in recordInfo.
+	recordMu sync.Mutex
+)
+
+// ObserveRecord counts a record write and keeps the per hostname gauges up to date. value is the address the record
+// holds afterward and is ignored for errors and deletions.
+func ObserveRecord(route string, hostname string, rrType string, outcome string, value string) {
+	recordUpdates.WithLabelValues(route, rrType, outcome).Inc()
+
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
+	switch outcome {
+	case OutcomeCreated, OutcomeUpdated:
+		recordLastUpdate.WithLabelValues(hostname, rrType).SetToCurrentTime()
+		fallthrough
+	case OutcomeUnchanged:
+		recordInfo.DeletePartialMatch(prometheus.Labels{"hostname": hostname, "rr_type": rrType})
+		// Without a value the record does not exist, e.g. after deleting a record that was already gone
+		if value != "" {
+			recordInfo.WithLabelValues(hostname, rrType, value).Set(1)
+		}
+	case OutcomeDeleted:
+		recordInfo.DeletePartialMatch(prometheus.Labels{"hostname": hostname, "rr_type": rrType})
+		recordLastUpdate.DeleteLabelValues(hostname, rrType)
+	}
+}
+
+func ValidationError(route string, reason string) {
+	validationErrors.WithLabelValues(route, reason).Inc()
+}
+
+func AuthFailure(route string) {
+	authFailures.WithLabelValues(route).Inc()
+}
+
+// ObserveAPICall records the latency of a provider API call that started at start and returned err.
+func ObserveAPICall(provider string, operation string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	apiCallDuration.WithLabelValues(provider, operation, status).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
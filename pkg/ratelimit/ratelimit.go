@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped, they behave the same as a new one.
+const sweepInterval = 10 * time.Minute
+
+// ParseLimit parses COUNT/PERIOD, e.g. 10/1m or 10/m for ten requests per minute. An empty value or 0 is unlimited.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+
+	count, period, found := strings.Cut(value, "/")
+
+	if !found {
+		return Limit{}, fmt.Errorf("%w: %q, expected COUNT/PERIOD", ErrInvalidLimit, value)
+	}
+
+	n, err := strconv.Atoi(count)
+
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("%w: %q, invalid count", ErrInvalidLimit, value)
+	}
+
+	// A bare unit counts once, "m" is read as "1m"
+	if period != "" && !strings.ContainsAny(period[:1], "0123456789") {
+		period = "1" + period
+	}
+
+	d, err := time.ParseDuration(period)
+
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q, invalid period", ErrInvalidLimit, value)
+	}
+
+	if n == 0 {
+		return Limit{}, nil
+	}
+
+	return Limit{Count: n, Period: d}, nil
+}
+
+// ParseLimits parses a comma separated list of CLASS=LIMIT, e.g. read=60/m,write=10/m.
+func ParseLimits(value string) (Limits, error) {
+	var limits Limits
+
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		class, spec, found := strings.Cut(field, "=")
+
+		if !found {
+			return Limits{}, fmt.Errorf("%w: %q, expected CLASS=COUNT/PERIOD", ErrInvalidLimit, field)
+		}
+
+		limit, err := ParseLimit(spec)
+
+		if err != nil {
+			return Limits{}, err
+		}
+
+		switch strings.TrimSpace(class) {
+		case ClassRead:
+			limits.Read = &limit
+		case ClassWrite:
+			limits.Write = &limit
+		default:
+			return Limits{}, fmt.Errorf("%w: unknown class %q, expected %s or %s", ErrInvalidLimit, class, ClassRead, ClassWrite)
+		}
+	}
+
+	return limits, nil
+}
+
+// Unlimited reports whether l allows every request.
+func (l Limit) Unlimited() bool {
+	return l.Count <= 0 || l.Period <= 0
+}
+
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", l.Count, l.Period)
+}
+
+// For returns the override of class, nil if there is none.
+func (l Limits) For(class string) *Limit {
+	switch class {
+	case ClassRead:
+		return l.Read
+	case ClassWrite:
+		return l.Write
+	}
+	return nil
+}
+
+// Limiter keeps a token bucket per key. It is safe for concurrent use.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	limit   Limit
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of every key, creating missing buckets with limit and adjusting existing ones
+// to it. If any bucket is empty no token is taken at all and the time until every bucket has one again is returned.
+func (l *Limiter) Allow(limit Limit, keys ...string) (bool, time.Duration) {
+	if limit.Unlimited() {
+		return true, 0
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(keys))
+	var wait time.Duration
+
+	for _, key := range keys {
+		b := l.bucket(key, limit)
+		r := b.limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+
+		if delay := r.DelayFrom(now); delay > wait {
+			wait = delay
+		}
+	}
+
+	if wait == 0 {
+		return true, 0
+	}
+
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+
+	return false, wait
+}
+
+func (l *Limiter) bucket(key string, limit Limit) *bucket {
+	every := rate.Every(limit.Period / time.Duration(limit.Count))
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(every, limit.Count), limit: limit}
+		l.buckets[key] = b
+	} else if b.limit != limit {
+		b.limiter.SetLimit(every)
+		b.limiter.SetBurst(limit.Count)
+		b.limit = limit
+	}
+
+	return b
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.limiter.TokensAt(now) >= float64(b.limiter.Burst()) {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,126 @@
+package ratelimit_test
+
+import (
+	"dyndns/pkg/ratelimit"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ratelimit.Limit
+	}{
+		{"", ratelimit.Limit{}},
+		{"0", ratelimit.Limit{}},
+		{"0/m", ratelimit.Limit{}},
+		{"10/1m", ratelimit.Limit{Count: 10, Period: time.Minute}},
+		{"10/m", ratelimit.Limit{Count: 10, Period: time.Minute}},
+		{" 100/24h ", ratelimit.Limit{Count: 100, Period: 24 * time.Hour}},
+		{"5/30s", ratelimit.Limit{Count: 5, Period: 30 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		got, err := ratelimit.ParseLimit(tt.value)
+
+		if err != nil || got != tt.want {
+			t.Fatalf("ParseLimit(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"10", "x/m", "-1/m", "10/", "10/0s", "10/-1m", "10/fortnight"} {
+		if _, err := ratelimit.ParseLimit(value); !errors.Is(err, ratelimit.ErrInvalidLimit) {
+			t.Fatalf("ParseLimit(%q) error = %v, want %v", value, err, ratelimit.ErrInvalidLimit)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ratelimit.ParseLimits("write=60/h, read=0")
+
+	if err != nil {
+		t.Fatalf("ParseLimits: %v", err)
+	}
+
+	if limits.Write == nil || *limits.Write != (ratelimit.Limit{Count: 60, Period: time.Hour}) {
+		t.Fatalf("write = %+v, want 60/h", limits.Write)
+	}
+
+	// An explicit 0 overrides the default of the server with unlimited
+	if limits.Read == nil || !limits.Read.Unlimited() {
+		t.Fatalf("read = %+v, want unlimited", limits.Read)
+	}
+
+	limits, err = ratelimit.ParseLimits("read=5/m")
+
+	if err != nil || limits.Write != nil || limits.For(ratelimit.ClassWrite) != nil {
+		t.Fatalf("ParseLimits(read=5/m) = %+v, %v, want no write override", limits, err)
+	}
+
+	for _, value := range []string{"write", "update=5/m", "write=5"} {
+		if _, err := ratelimit.ParseLimits(value); !errors.Is(err, ratelimit.ErrInvalidLimit) {
+			t.Fatalf("ParseLimits(%q) error = %v, want %v", value, err, ratelimit.ErrInvalidLimit)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	limiter := ratelimit.NewLimiter()
+	limit := ratelimit.Limit{Count: 2, Period: time.Minute}
+
+	for i := 0; i < limit.Count; i++ {
+		if allowed, _ := limiter.Allow(limit, "ip:192.0.2.1"); !allowed {
+			t.Fatalf("request %d rejected, want the burst of %d allowed", i+1, limit.Count)
+		}
+	}
+
+	allowed, wait := limiter.Allow(limit, "ip:192.0.2.1")
+
+	if allowed || wait <= 0 || wait > limit.Period/time.Duration(limit.Count) {
+		t.Fatalf("Allow = %v, %v, want rejected with a wait of at most %v", allowed, wait, limit.Period/2)
+	}
+
+	if allowed, _ := limiter.Allow(limit, "ip:192.0.2.2"); !allowed {
+		t.Fatal("other key rejected, want its own bucket")
+	}
+}
+
+func TestAllowTakesAllOrNothing(t *testing.T) {
+	limiter := ratelimit.NewLimiter()
+	limit := ratelimit.Limit{Count: 1, Period: time.Minute}
+
+	limiter.Allow(limit, "user:alice")
+
+	// The empty user bucket rejects the request, so the bucket of the address keeps its token
+	if allowed, _ := limiter.Allow(limit, "ip:192.0.2.1", "user:alice"); allowed {
+		t.Fatal("request allowed with an empty user bucket")
+	}
+
+	if allowed, _ := limiter.Allow(limit, "ip:192.0.2.1"); !allowed {
+		t.Fatal("address bucket drained by a rejected request")
+	}
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	limiter := ratelimit.NewLimiter()
+
+	for i := 0; i < 100; i++ {
+		if allowed, _ := limiter.Allow(ratelimit.Limit{}, "ip:192.0.2.1"); !allowed {
+			t.Fatal("request rejected by the zero Limit")
+		}
+	}
+}
+
+func TestAllowAdjustsLimit(t *testing.T) {
+	limiter := ratelimit.NewLimiter()
+
+	limiter.Allow(ratelimit.Limit{Count: 1, Period: time.Minute}, "ip:192.0.2.1")
+
+	raised := ratelimit.Limit{Count: 100, Period: time.Second}
+
+	// A reload raised the limit, the existing bucket refills at the new rate instead of waiting out the old one
+	if _, wait := limiter.Allow(raised, "ip:192.0.2.1"); wait > raised.Period/time.Duration(raised.Count) {
+		t.Fatalf("wait = %v after the limit was raised, want at most %v", wait, raised.Period/time.Duration(raised.Count))
+	}
+}
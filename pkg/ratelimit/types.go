@@ -0,0 +1,29 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidLimit = errors.New("invalid rate limit")
+)
+
+// Request classes with separate limits. Writes change records and cost provider API calls, reads do not.
+const (
+	ClassRead  = "read"
+	ClassWrite = "write"
+)
+
+// Limit allows Count requests per Period. A client that stayed quiet for a Period may send all Count at once. The
+// zero Limit allows everything.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// Limits overrides the limits of the request classes, a nil Limit keeps the default of the server.
+type Limits struct {
+	Read  *Limit
+	Write *Limit
+}
@@ -0,0 +1,108 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pires/go-proxyproto"
+)
+
+// ProxyHeaderTimeout limits how long an accepted connection may take to send its PROXY protocol header.
+const ProxyHeaderTimeout = 5 * time.Second
+
+// ParseTrustedProxies parses a comma separated list of CIDRs or single addresses.
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, entry)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, entry)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// NewExtractor returns the echo IP extractor for source. Headers are only honoured if the request comes from one of
+// the trusted proxies. Without trusted proxies the loopback, link-local and private networks are trusted.
+func NewExtractor(source string, trusted []*net.IPNet) (echo.IPExtractor, error) {
+	var options []echo.TrustOption
+
+	if len(trusted) > 0 {
+		options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+
+		for _, network := range trusted {
+			options = append(options, echo.TrustIPRange(network))
+		}
+	}
+
+	switch strings.ToLower(source) {
+	case SourceDirect:
+		return echo.ExtractIPDirect(), nil
+	case SourceXRealIP:
+		return echo.ExtractIPFromRealIPHeader(options...), nil
+	case SourceXFF:
+		return echo.ExtractIPFromXFFHeader(options...), nil
+	}
+
+	return nil, fmt.Errorf("%w %q: use %s, %s or %s", ErrUnknownSource, source, SourceDirect, SourceXRealIP, SourceXFF)
+}
+
+// NewProxyProtocolListener wraps listener so that connections may start with a PROXY protocol v1 or v2 header. The
+// address in the header replaces the address of the connection if the upstream is one of the trusted proxies, or any
+// upstream if none are given. Other upstreams sending a header are rejected.
+func NewProxyProtocolListener(listener net.Listener, trusted []*net.IPNet) net.Listener {
+	return &proxyproto.Listener{
+		Listener:          listener,
+		ReadHeaderTimeout: ProxyHeaderTimeout,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if len(trusted) == 0 {
+				return proxyproto.USE, nil
+			}
+
+			// Returning an error would stop the server from accepting connections, so unknown upstreams are rejected
+			tcpAddr, ok := upstream.(*net.TCPAddr)
+
+			if !ok {
+				return proxyproto.REJECT, nil
+			}
+
+			for _, network := range trusted {
+				if network.Contains(tcpAddr.IP) {
+					return proxyproto.USE, nil
+				}
+			}
+
+			return proxyproto.REJECT, nil
+		},
+	}
+}
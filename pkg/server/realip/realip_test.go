@@ -0,0 +1,225 @@
+package realip_test
+
+import (
+	"dyndns/pkg/server/realip"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func mustParseTrustedProxies(t *testing.T, value string) []*net.IPNet {
+	t.Helper()
+
+	trusted, err := realip.ParseTrustedProxies(value)
+
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies(%q): %v", value, err)
+	}
+
+	return trusted
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted := mustParseTrustedProxies(t, "10.0.0.0/8, 192.0.2.1,2001:db8::1,")
+
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::1/128"}
+
+	if len(trusted) != len(want) {
+		t.Fatalf("trusted = %v, want %v", trusted, want)
+	}
+
+	for i, network := range trusted {
+		if network.String() != want[i] {
+			t.Fatalf("trusted[%d] = %s, want %s", i, network, want[i])
+		}
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "bogus", "10.0.0.0/8,not-an-ip"} {
+		if _, err := realip.ParseTrustedProxies(value); !errors.Is(err, realip.ErrInvalidProxy) {
+			t.Fatalf("ParseTrustedProxies(%q) error = %v, want %v", value, err, realip.ErrInvalidProxy)
+		}
+	}
+}
+
+func TestNewExtractor(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		trusted    string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{
+			name:       "direct ignores the headers",
+			source:     realip.SourceDirect,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        "1.1.1.1",
+			xRealIP:    "1.1.1.1",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "xff spoofed by an untrusted peer",
+			source:     realip.SourceXFF,
+			trusted:    "10.0.0.0/8",
+			remoteAddr: "8.8.8.8:1234",
+			xff:        "1.1.1.1",
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "xff right-most untrusted hop",
+			source:     realip.SourceXFF,
+			trusted:    "10.0.0.0/8",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        "1.1.1.1, 9.9.9.9, 10.0.0.2",
+			want:       "9.9.9.9",
+		},
+		{
+			name:       "xff private peer trusted by default",
+			source:     realip.SourceXFF,
+			remoteAddr: "192.168.1.1:1234",
+			xff:        "9.9.9.9",
+			want:       "9.9.9.9",
+		},
+		{
+			name:       "xff private peer not in the trusted proxies",
+			source:     realip.SourceXFF,
+			trusted:    "10.0.0.0/8",
+			remoteAddr: "192.168.1.1:1234",
+			xff:        "9.9.9.9",
+			want:       "192.168.1.1",
+		},
+		{
+			name:       "x-real-ip from a trusted peer",
+			source:     realip.SourceXRealIP,
+			trusted:    "10.0.0.0/8",
+			remoteAddr: "10.0.0.1:1234",
+			xRealIP:    "9.9.9.9",
+			xff:        "1.1.1.1",
+			want:       "9.9.9.9",
+		},
+		{
+			name:       "x-real-ip spoofed by an untrusted peer",
+			source:     realip.SourceXRealIP,
+			trusted:    "10.0.0.0/8",
+			remoteAddr: "8.8.8.8:1234",
+			xRealIP:    "1.1.1.1",
+			want:       "8.8.8.8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := realip.NewExtractor(tt.source, mustParseTrustedProxies(t, tt.trusted))
+
+			if err != nil {
+				t.Fatalf("NewExtractor: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/dyn", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			if tt.xRealIP != "" {
+				req.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+
+			if got := extractor(req); got != tt.want {
+				t.Fatalf("address = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewExtractorUnknownSource(t *testing.T) {
+	if _, err := realip.NewExtractor("forwarded", nil); !errors.Is(err, realip.ErrUnknownSource) {
+		t.Fatalf("error = %v, want %v", err, realip.ErrUnknownSource)
+	}
+}
+
+// acceptWithHeader sends a PROXY protocol header for source through a listener that trusts trusted and returns the
+// accepted connection.
+func acceptWithHeader(t *testing.T, trusted string, source *net.TCPAddr) net.Conn {
+	t.Helper()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	listener := realip.NewProxyProtocolListener(inner, mustParseTrustedProxies(t, trusted))
+	t.Cleanup(func() { _ = listener.Close() })
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	t.Cleanup(func() { _ = client.Close() })
+
+	header := proxyproto.HeaderProxyFromAddrs(1, source, inner.Addr())
+
+	if _, err := header.WriteTo(client); err != nil {
+		t.Fatalf("write PROXY header: %v", err)
+	}
+
+	if _, err := client.Write([]byte("x")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	conn, err := listener.Accept()
+
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestProxyProtocolPolicy(t *testing.T) {
+	source := &net.TCPAddr{IP: net.ParseIP("9.9.9.9"), Port: 4321}
+
+	tests := []struct {
+		name    string
+		trusted string
+		use     bool
+	}{
+		{name: "any upstream without trusted proxies", trusted: "", use: true},
+		{name: "trusted upstream", trusted: "127.0.0.0/8", use: true},
+		{name: "untrusted upstream", trusted: "10.0.0.0/8", use: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptWithHeader(t, tt.trusted, source)
+
+			_, err := conn.Read(make([]byte, 1))
+
+			if !tt.use {
+				if !errors.Is(err, proxyproto.ErrSuperfluousProxyHeader) {
+					t.Fatalf("Read error = %v, want %v", err, proxyproto.ErrSuperfluousProxyHeader)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+
+			if got := conn.RemoteAddr().String(); got != source.String() {
+				t.Fatalf("remote address = %s, want %s from the header", got, source)
+			}
+		})
+	}
+}
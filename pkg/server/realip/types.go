@@ -0,0 +1,15 @@
+package realip
+
+import "errors"
+
+var (
+	ErrUnknownSource = errors.New("unknown IP source")
+	ErrInvalidProxy  = errors.New("invalid trusted proxy")
+)
+
+// Sources the client address can be taken from.
+const (
+	SourceDirect  = "direct"
+	SourceXRealIP = "x-real-ip"
+	SourceXFF     = "xff"
+)
@@ -1,204 +1,276 @@
 package routes
 
 import (
+	"dyndns/pkg/auth"
 	"dyndns/pkg/dns"
+	"dyndns/pkg/ratelimit"
 	types "dyndns/pkg/server"
-	"dyndns/pkg/utils"
 	"errors"
 	"github.com/labstack/echo/v4"
-	"log"
 	"net"
 	"net/http"
+	"strings"
 )
 
-func MountDynRoute(e *echo.Echo, cfg *Config) {
+func MountDynRoute(e *echo.Echo, config ConfigFunc) {
 	e.GET("/dyn", func(c echo.Context) error {
+		cfg := config(c)
+
+		if !limitRequest(c, cfg, ratelimit.ClassWrite) {
+			return tooManyRequests(c)
+		}
 
 		v4Address := c.QueryParam("ip_address")
 		v6Address := c.QueryParam("ipv6_address")
 
+		if auto := c.QueryParam("auto"); auto == "true" || auto == "1" || v4Address == "auto" || v6Address == "auto" {
+			v4Address, v6Address = detectAddress(c, v4Address, v6Address, auto == "true" || auto == "1")
+		}
+
 		if v4Address == "" && v6Address == "" {
-			log.Printf("[DynDNS Server][From:%s][Status:Error]: %s", c.RealIP(), "No IP address provided")
+			reject(c, cfg, target{hostnames: requestedHostnames(c, cfg)}, ReasonNoAddress, "No IP address provided")
 			return c.JSON(http.StatusBadRequest, map[string]string{
 				"error":  "No IP address provided",
-				"detail": "Provide either an IPv4 (ip_address) or an IPv6 (ipv6_address) address or both to update the DNS record",
+				"detail": "Provide either an IPv4 (ip_address) or an IPv6 (ipv6_address) address or both to update the DNS record, or auto=true to use the address of the request",
 			})
 		}
 
-		result := types.UpdateResult{
-			Name: cfg.DomainName,
-			V4: &dns.UpdateResult{
-				RRType:  "A",
-				Success: false,
-				Created: false,
-				Updated: false,
-				Value:   "",
-				Error:   nil,
-			},
-			V6: &dns.UpdateResult{
-				RRType:  "AAAA",
-				Success: false,
-				Created: false,
-				Updated: false,
-				Value:   "",
-				Error:   nil,
-			},
-		}
+		var hostnames []string
+		var ttls []int
 
-		if v4Address != "" {
-			parsed := net.ParseIP(v4Address)
+		for _, hostname := range strings.Split(c.QueryParam("hostname"), ",") {
+			resolved, status, response := authorizeHostname(c, cfg, hostname)
 
-			if parsed == nil {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:-]: %s", c.RealIP(), "Invalid IP address")
-				result.V4.Error = errors.New("invalid IP address")
+			if response != nil {
+				return c.JSON(status, response)
 			}
 
-			if parsed.IsLoopback() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Loopback IP address")
-				result.V4.Error = errors.New("loopback IP address")
-			}
-
-			if parsed.IsUnspecified() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Unspecified IP address")
-				result.V4.Error = errors.New("unspecified IP address")
-			}
-
-			if parsed.IsMulticast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Multicast IP address")
-				result.V4.Error = errors.New("multicast IP address")
-			}
+			ttl, err := cfg.ResolveTTL(resolved, c.QueryParam("ttl"))
 
-			if parsed.IsLinkLocalUnicast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Link-local unicast IP address")
-				result.V4.Error = errors.New("link-local unicast IP address")
+			if err != nil {
+				reject(c, cfg, target{hostnames: []string{resolved}}, errorReason(err), "Invalid TTL", "error", err)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":  err.Error(),
+					"detail": "Provide the TTL (ttl) in seconds or omit it to use the default of the server",
+				})
 			}
 
-			if parsed.IsPrivate() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Private IP address")
-				result.V4.Error = errors.New("private IP address")
-			}
+			hostnames = append(hostnames, resolved)
+			ttls = append(ttls, ttl)
+		}
 
-			if parsed.IsInterfaceLocalMulticast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Interface-local multicast IP address")
-				result.V4.Error = errors.New("interface-local multicast IP address")
-			}
+		if !limitHostnames(c, cfg, ratelimit.ClassWrite, hostnames) {
+			return tooManyRequests(c)
+		}
 
-			if parsed.IsLinkLocalMulticast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Link-local multicast IP address")
-				result.V4.Error = errors.New("link-local multicast IP address")
-			}
+		var v4Error, v6Error error
 
-			if parsed.To4() == nil {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "IPv6 address")
-				result.V4.Error = errors.New("IPv6 address")
-			}
+		if v4Address != "" {
+			parsed, err := validateAddress(v4Address, false)
 
-			if utils.IsReservedOrUnroutableIP(parsed) && result.V4.Error == nil {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Reserved or unroutable IP address")
-				result.V4.Error = errors.New("reserved or unroutable IP address")
+			if err != nil {
+				reject(c, cfg, target{hostnames: hostnames, rrType: "A", value: v4Address}, ReasonInvalidAddress, "Invalid IP address", "error", err)
+				v4Error = err
+			} else {
+				v4Address = parsed.String() // Normalize the address so it compares equal to the stored value
 			}
 		} else {
-			result.V4.Error = errors.New("no IP address provided")
+			v4Error = errors.New("no IP address provided")
 		}
 
 		if v6Address != "" {
-			parsed := net.ParseIP(v6Address)
+			parsed, err := validateAddress(v6Address, true)
 
-			if parsed == nil {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:-]: %s", c.RealIP(), "Invalid IP address")
-				result.V6.Error = errors.New("invalid IP address")
+			if err != nil {
+				reject(c, cfg, target{hostnames: hostnames, rrType: "AAAA", value: v6Address}, ReasonInvalidAddress, "Invalid IP address", "error", err)
+				v6Error = err
+			} else {
+				v6Address = parsed.String() // Normalize the address so it compares equal to the stored value
 			}
+		}
 
-			if parsed.IsLoopback() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Loopback IP address")
-				result.V6.Error = errors.New("loopback IP address")
-			}
+		if v4Error != nil {
+			v4Address = "" // Clear the IP address if it's invalid
+		}
 
-			if parsed.IsUnspecified() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Unspecified IP address")
-				result.V6.Error = errors.New("unspecified IP address")
-			}
+		if v6Error != nil {
+			v6Address = "" // Clear the IP address if it's invalid
+		}
 
-			if parsed.IsMulticast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Multicast IP address")
-				result.V6.Error = errors.New("multicast IP address")
-			}
+		var results []types.UpdateResult
 
-			if parsed.IsLinkLocalUnicast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Link-local unicast IP address")
-				result.V6.Error = errors.New("link-local unicast IP address")
-			}
+		for i, hostname := range hostnames {
+			results = append(results, updateHostname(c, cfg, hostname, ttls[i], v4Address, v4Error, v6Address, v6Error))
+		}
 
-			if parsed.IsPrivate() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Private IP address")
-				result.V6.Error = errors.New("private IP address")
-			}
+		if len(results) == 1 {
+			return c.JSON(http.StatusOK, results[0])
+		}
 
-			if parsed.IsInterfaceLocalMulticast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Interface-local multicast IP address")
-				result.V6.Error = errors.New("interface-local multicast IP address")
-			}
+		return c.JSON(http.StatusOK, results)
+	})
 
-			if parsed.IsLinkLocalMulticast() {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Link-local multicast IP address")
-				result.V6.Error = errors.New("link-local multicast IP address")
-			}
+	e.DELETE("/dyn", func(c echo.Context) error {
+		cfg := config(c)
 
-			if parsed.To16() == nil {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "IPv4 address")
-				result.V6.Error = errors.New("IPv4 address")
-			}
+		if !limitRequest(c, cfg, ratelimit.ClassWrite) {
+			return tooManyRequests(c)
+		}
 
-			if utils.IsReservedOrUnroutableIP(parsed) && result.V6.Error == nil {
-				log.Printf("[DynDNS Server][From:%s][Status:Error][IP:%s]: %s", c.RealIP(), parsed.String(), "Reserved or unroutable IP address")
-				result.V6.Error = errors.New("reserved or unroutable IP address")
-			}
+		family := c.QueryParam("family")
+		v4 := family == "" || family == "both" || family == "v4"
+		v6 := family == "" || family == "both" || family == "v6"
+
+		if !v4 && !v6 {
+			reject(c, cfg, target{hostnames: requestedHostnames(c, cfg)}, ReasonInvalidFamily, "Invalid address family", "family", family)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":  "Invalid address family",
+				"detail": "Provide the address family (family) v4, v6 or both, or omit it to delete both records",
+			})
 		}
 
-		if result.V4.Error != nil {
-			v4Address = "" // Clear the IP address if it's invalid
+		var hostnames []string
+
+		for _, hostname := range strings.Split(c.QueryParam("hostname"), ",") {
+			resolved, status, response := authorizeHostname(c, cfg, hostname)
+
+			if response != nil {
+				return c.JSON(status, response)
+			}
+
+			hostnames = append(hostnames, resolved)
 		}
 
-		if result.V6.Error != nil {
-			v6Address = "" // Clear the IP address if it's invalid
+		if !limitHostnames(c, cfg, ratelimit.ClassWrite, hostnames) {
+			return tooManyRequests(c)
 		}
 
-		v4Result, v6Result := cfg.CloudDNS.UpdateDNSRecord(v4Address, v6Address)
+		var results []types.UpdateResult
 
-		if v4Result != nil {
-			result.V4 = v4Result
-			result.V4.Name = "" // Clear the domain name - its already in the parent struct
-			if v4Result.Success {
-				parsed := net.ParseIP(v4Address)
-				if v4Result.Created {
-					log.Printf("[DynDNS Server][Type:A][From:%s][Status:Created][Domain:%s][IP:%s]: %s", c.RealIP(), cfg.DomainName, parsed.String(), "DNS record created")
-				} else if v4Result.Updated {
-					log.Printf("[DynDNS Server][Type:A][From:%s][Status:Updated][Domain:%s][IP:%s]: %s", c.RealIP(), cfg.DomainName, parsed.String(), "DNS record updated")
-				}
-			} else {
-				if result.V4.Error == nil {
-					result.V4.Error = errors.New("no IP address provided")
-				}
-			}
+		for _, hostname := range hostnames {
+			results = append(results, deleteHostname(c, cfg, hostname, v4, v6))
 		}
 
-		if v6Result != nil {
-			result.V6 = v6Result
-			result.V6.Name = "" // Clear the domain name - its already in the parent struct
-			if v6Result.Success {
-				parsed := net.ParseIP(v6Address)
-				if v6Result.Created {
-					log.Printf("[DynDNS Server][Type:AAAA][From:%s][Status:Created][Domain:%s][IP:%s]: %s", c.RealIP(), cfg.DomainName, parsed.String(), "DNS record created")
-				} else if v6Result.Updated {
-					log.Printf("[DynDNS Server][Type:AAAA][From:%s][Status:Updated][Domain:%s][IP:%s]: %s", c.RealIP(), cfg.DomainName, parsed.String(), "DNS record updated")
-				}
-			} else {
-				if result.V6.Error == nil {
-					result.V6.Error = errors.New("no IP address provided")
-				}
-			}
+		if len(results) == 1 {
+			return c.JSON(http.StatusOK, results[0])
 		}
 
-		return c.JSON(http.StatusOK, result)
+		return c.JSON(http.StatusOK, results)
 	})
 }
+
+// authorizeHostname resolves the hostname query parameter and checks that the authenticated user may change it.
+// On failure it returns the status and body of the error response instead.
+func authorizeHostname(c echo.Context, cfg *Config, hostname string) (string, int, map[string]string) {
+	resolved, err := cfg.ResolveHostname(hostname)
+
+	if err != nil {
+		reject(c, cfg, target{hostnames: []string{hostname}}, errorReason(err), "Invalid hostname", "error", err)
+		return "", http.StatusBadRequest, map[string]string{
+			"error":  err.Error(),
+			"detail": "Provide a hostname (hostname) inside the zone " + cfg.Zone + " that is managed by this server",
+		}
+	}
+
+	if user, ok := c.Get(auth.ContextKeyUser).(*auth.User); ok && !user.MayUpdate(resolved) {
+		reject(c, cfg, target{hostnames: []string{resolved}}, errorReason(ErrHostnameForbidden), "Hostname forbidden", "user", user.Name)
+		return "", http.StatusForbidden, map[string]string{
+			"error":  ErrHostnameForbidden.Error(),
+			"detail": "User " + user.Name + " may not update " + resolved,
+		}
+	}
+
+	return resolved, 0, nil
+}
+
+func deleteHostname(c echo.Context, cfg *Config, hostname string, v4 bool, v6 bool) types.UpdateResult {
+
+	result := types.UpdateResult{
+		Name: hostname,
+	}
+
+	result.V4, result.V6 = cfg.CloudDNS.DeleteDNSRecord(hostname, v4, v6)
+
+	for _, r := range []*dns.UpdateResult{result.V4, result.V6} {
+		if r == nil {
+			continue
+		}
+
+		r.Name = "" // Clear the domain name - its already in the parent struct
+		reportResult(c, cfg, hostname, r)
+	}
+
+	return result
+}
+
+func updateHostname(c echo.Context, cfg *Config, hostname string, ttl int, v4Address string, v4Error error, v6Address string, v6Error error) types.UpdateResult {
+
+	result := types.UpdateResult{
+		Name: hostname,
+		V4: &dns.UpdateResult{
+			RRType:  "A",
+			Success: false,
+			Created: false,
+			Updated: false,
+			Value:   "",
+			Error:   v4Error,
+		},
+		V6: &dns.UpdateResult{
+			RRType:  "AAAA",
+			Success: false,
+			Created: false,
+			Updated: false,
+			Value:   "",
+			Error:   v6Error,
+		},
+	}
+
+	v4Result, v6Result := cfg.CloudDNS.UpdateDNSRecord(hostname, v4Address, v6Address, ttl)
+
+	reportResult(c, cfg, hostname, v4Result)
+	reportResult(c, cfg, hostname, v6Result)
+
+	if v4Result != nil {
+		result.V4 = v4Result
+		result.V4.Name = "" // Clear the domain name - its already in the parent struct
+		if !v4Result.Success && result.V4.Error == nil {
+			result.V4.Error = errors.New("no IP address provided")
+		}
+	}
+
+	if v6Result != nil {
+		result.V6 = v6Result
+		result.V6.Name = "" // Clear the domain name - its already in the parent struct
+		if !v6Result.Success && result.V6.Error == nil {
+			result.V6.Error = errors.New("no IP address provided")
+		}
+	}
+
+	return result
+}
+
+// detectAddress fills in the address of the caller for the family the request arrived on. With auto set it fills
+// whichever family is empty, otherwise only the field set to "auto". An "auto" of the other family is cleared.
+func detectAddress(c echo.Context, v4Address string, v6Address string, auto bool) (string, string) {
+	ip := net.ParseIP(c.RealIP())
+	isV4 := ip != nil && ip.To4() != nil
+	isV6 := ip != nil && ip.To4() == nil
+
+	if v4Address == "auto" || (auto && v4Address == "") {
+		v4Address = ""
+		if isV4 {
+			v4Address = ip.String()
+		}
+	}
+
+	if v6Address == "auto" || (auto && v6Address == "") {
+		v6Address = ""
+		if isV6 {
+			v6Address = ip.String()
+		}
+	}
+
+	RequestLogger(c).Info("Using the address of the request")
+
+	return v4Address, v6Address
+}
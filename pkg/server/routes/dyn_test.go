@@ -0,0 +1,298 @@
+package routes_test
+
+import (
+	"dyndns/pkg/dns"
+	types "dyndns/pkg/server"
+	"dyndns/pkg/server/routes"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testDomainName = "home.example.com."
+	testZone       = "example.com."
+)
+
+// newTestConfig returns a Config for testDomainName backed by a MemoryService with options.
+func newTestConfig(options dns.MemoryOptions) (*routes.Config, *dns.MemoryService) {
+	service := dns.NewMemoryService(testDomainName, &options)
+
+	return &routes.Config{
+		DomainName: testDomainName,
+		Zone:       testZone,
+		Hostnames:  []string{"office.example.com."},
+		CloudDNS:   service,
+		Provider:   "memory",
+	}, service
+}
+
+// newTestServer mounts the routes on a fresh echo instance that always uses cfg.
+func newTestServer(cfg *routes.Config) *echo.Echo {
+	e := echo.New()
+	config := func(echo.Context) *routes.Config { return cfg }
+
+	routes.MountDynRoute(e, config)
+	routes.MountNicRoute(e, config)
+	routes.MountHistoryRoute(e, config)
+
+	return e
+}
+
+func serve(e *echo.Echo, method string, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeUpdateResult(t *testing.T, rec *httptest.ResponseRecorder) types.UpdateResult {
+	t.Helper()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s, want 200", rec.Code, rec.Body.String())
+	}
+
+	var result types.UpdateResult
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+
+	return result
+}
+
+func assertMemoryRecord(t *testing.T, service *dns.MemoryService, name string, rrType string, want string) {
+	t.Helper()
+
+	value, ok := service.Record(name, rrType)
+
+	if want == "" && ok {
+		t.Fatalf("%s %s record = %s, want none", name, rrType, value)
+	}
+
+	if want != "" && value != want {
+		t.Fatalf("%s %s record = %q, want %s", name, rrType, value, want)
+	}
+}
+
+func TestDynCreate(t *testing.T) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	e := newTestServer(cfg)
+
+	result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1&ipv6_address=2001:db8::1"))
+
+	if result.Name != testDomainName {
+		t.Fatalf("name = %s, want %s", result.Name, testDomainName)
+	}
+
+	for _, r := range []*dns.UpdateResult{result.V4, result.V6} {
+		if r == nil || !r.Success || !r.Created || r.Updated || r.Error != nil {
+			t.Fatalf("result = %+v, want created", r)
+		}
+	}
+
+	assertMemoryRecord(t, service, testDomainName, "A", "1.1.1.1")
+	assertMemoryRecord(t, service, testDomainName, "AAAA", "2001:db8::1")
+}
+
+func TestDynUpdate(t *testing.T) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	e := newTestServer(cfg)
+	service.UpdateDNSRecord(testDomainName, "1.1.1.1", "", 0)
+
+	result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=1.0.0.1&ttl=300"))
+
+	if !result.V4.Success || !result.V4.Updated || result.V4.PreviousValue != "1.1.1.1" || result.V4.TTL != 300 {
+		t.Fatalf("A result = %+v, want updated from 1.1.1.1", result.V4)
+	}
+
+	// Only the IPv4 address was sent, the AAAA record is left alone
+	if result.V6.Success || result.V6.Updated || result.V6.Error != nil {
+		t.Fatalf("AAAA result = %+v, want untouched", result.V6)
+	}
+
+	assertMemoryRecord(t, service, testDomainName, "A", "1.0.0.1")
+}
+
+func TestDynUnchanged(t *testing.T) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	e := newTestServer(cfg)
+	service.UpdateDNSRecord(testDomainName, "1.1.1.1", "", 0)
+
+	result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1"))
+
+	if !result.V4.Success || !result.V4.Unchanged || result.V4.Updated || result.V4.Created {
+		t.Fatalf("A result = %+v, want unchanged", result.V4)
+	}
+}
+
+func TestDynBadAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "unparsable", query: "ip_address=bogus", want: "invalid IP address"},
+		{name: "loopback", query: "ip_address=127.0.0.1", want: "loopback IP address"},
+		{name: "private", query: "ip_address=10.0.0.1", want: "private IP address"},
+		{name: "reserved", query: "ip_address=192.0.2.1", want: "reserved or unroutable IP address"},
+		{name: "wrong family", query: "ip_address=2001:db8::1", want: "IPv6 address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, service := newTestConfig(dns.MemoryOptions{})
+			e := newTestServer(cfg)
+
+			result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?"+tt.query))
+
+			if result.V4.Success || result.V4.Error == nil || result.V4.Error.Error() != tt.want {
+				t.Fatalf("A result = %+v, want error %q", result.V4, tt.want)
+			}
+
+			assertMemoryRecord(t, service, testDomainName, "A", "")
+		})
+	}
+}
+
+func TestDynBadAddressKeepsOtherFamily(t *testing.T) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	e := newTestServer(cfg)
+
+	result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=bogus&ipv6_address=2001:db8::1"))
+
+	if result.V4.Success || result.V4.Error == nil {
+		t.Fatalf("A result = %+v, want failure", result.V4)
+	}
+
+	if !result.V6.Success || !result.V6.Created {
+		t.Fatalf("AAAA result = %+v, want created", result.V6)
+	}
+
+	assertMemoryRecord(t, service, testDomainName, "AAAA", "2001:db8::1")
+}
+
+func TestDynRejectsRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{name: "no address", target: "/dyn", status: http.StatusBadRequest},
+		{name: "hostname outside the zone", target: "/dyn?ip_address=1.1.1.1&hostname=example.org", status: http.StatusBadRequest},
+		{name: "hostname not managed", target: "/dyn?ip_address=1.1.1.1&hostname=other", status: http.StatusBadRequest},
+		{name: "invalid ttl", target: "/dyn?ip_address=1.1.1.1&ttl=abc", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, service := newTestConfig(dns.MemoryOptions{})
+			e := newTestServer(cfg)
+
+			rec := serve(e, http.MethodGet, tt.target)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body.String(), tt.status)
+			}
+
+			assertMemoryRecord(t, service, testDomainName, "A", "")
+		})
+	}
+}
+
+func TestDynSeveralHostnames(t *testing.T) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	e := newTestServer(cfg)
+
+	rec := serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1&hostname=home,office")
+
+	var results []types.UpdateResult
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 2 {
+		t.Fatalf("response = %d %s, want 2 results", rec.Code, rec.Body.String())
+	}
+
+	assertMemoryRecord(t, service, testDomainName, "A", "1.1.1.1")
+	assertMemoryRecord(t, service, "office.example.com.", "A", "1.1.1.1")
+}
+
+func TestDynInjectedError(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		fail     string
+	}{
+		{name: "get", fail: dns.MemoryOperationGet},
+		{name: "create", fail: dns.MemoryOperationCreate},
+		{name: "patch", existing: "1.0.0.1", fail: dns.MemoryOperationPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, service := newTestConfig(dns.MemoryOptions{})
+			e := newTestServer(cfg)
+
+			if tt.existing != "" {
+				service.UpdateDNSRecord(testDomainName, tt.existing, "", 0)
+			}
+
+			service.SetOptions(dns.MemoryOptions{Fail: []string{tt.fail}})
+
+			result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1"))
+
+			if result.V4.Success || result.V4.Error == nil || !strings.Contains(result.V4.Error.Error(), dns.ErrMemoryInjected.Error()) {
+				t.Fatalf("A result = %+v, want the injected error", result.V4)
+			}
+
+			service.SetOptions(dns.MemoryOptions{})
+			assertMemoryRecord(t, service, testDomainName, "A", tt.existing)
+		})
+	}
+}
+
+func TestDynLatency(t *testing.T) {
+	latency := 50 * time.Millisecond
+	cfg, _ := newTestConfig(dns.MemoryOptions{Latency: latency})
+	e := newTestServer(cfg)
+
+	start := time.Now()
+	result := decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1"))
+	elapsed := time.Since(start)
+
+	if !result.V4.Success || !result.V4.Created {
+		t.Fatalf("A result = %+v, want created", result.V4)
+	}
+
+	// A create reads the record first, so the request waits for two operations
+	if elapsed < 2*latency {
+		t.Fatalf("request took %v, want at least %v", elapsed, 2*latency)
+	}
+}
+
+func TestDynDelete(t *testing.T) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	e := newTestServer(cfg)
+	service.UpdateDNSRecord(testDomainName, "1.1.1.1", "2001:db8::1", 0)
+
+	result := decodeUpdateResult(t, serve(e, http.MethodDelete, "/dyn?family=v4"))
+
+	if result.V6 != nil {
+		t.Fatalf("AAAA result = %+v, want nil", result.V6)
+	}
+
+	if !result.V4.Success || !result.V4.Deleted || result.V4.PreviousValue != "1.1.1.1" {
+		t.Fatalf("A result = %+v, want deleted", result.V4)
+	}
+
+	assertMemoryRecord(t, service, testDomainName, "A", "")
+	assertMemoryRecord(t, service, testDomainName, "AAAA", "2001:db8::1")
+
+	if rec := serve(e, http.MethodDelete, "/dyn?family=v5"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 for an invalid family", rec.Code)
+	}
+}
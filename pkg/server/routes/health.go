@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"dyndns/pkg/dns"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status values of the health routes.
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthResult is the body of /healthz and /readyz.
+type HealthResult struct {
+	Status   string `json:"status"`
+	Provider string `json:"provider,omitempty"`
+	// CheckedAt is when the backend was last asked, Cached is set if this response reused that answer.
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Cached    bool       `json:"cached,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ReadyCheckTimeout bounds how long /readyz waits for the backend. A check still running by then is reported as
+// failed, so a hanging API call cannot block the probes.
+const ReadyCheckTimeout = 10 * time.Second
+
+var ErrReadyCheckTimeout = errors.New("DNS backend check timed out")
+
+// readiness remembers the last backend check, so probes arriving every few seconds do not each cost an API call.
+type readiness struct {
+	mu      sync.Mutex
+	service dns.DynDNSService
+	checked time.Time
+	err     error
+	// running is closed when the check of runningFor started at started finishes, nil while no check runs.
+	running    chan struct{}
+	runningFor dns.DynDNSService
+	started    time.Time
+	// timedOut is set once probes reported the running check as timed out.
+	timedOut bool
+}
+
+// check returns the result of the last check of service if it is younger than interval, otherwise it asks the
+// backend. Concurrent probes wait for the running check instead of starting their own. The backend is asked without
+// holding the lock, and no probe waits longer than ReadyCheckTimeout for it.
+func (r *readiness) check(service dns.DynDNSService, interval time.Duration) (checked time.Time, cached bool, err error) {
+	r.mu.Lock()
+
+	// a reload may have replaced the service, its predecessor's result says nothing about it
+	if r.service == service && !r.checked.IsZero() && time.Since(r.checked) < interval {
+		defer r.mu.Unlock()
+		return r.checked, true, r.err
+	}
+
+	starter := r.running == nil || r.runningFor != service
+
+	if starter {
+		r.running, r.runningFor, r.started = make(chan struct{}), service, time.Now()
+		go r.run(service, r.running)
+	}
+
+	done, started := r.running, r.started
+	r.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(started.Add(ReadyCheckTimeout)))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		if starter {
+			r.mu.Lock()
+			r.timedOut = true
+			r.mu.Unlock()
+			slog.Warn("DNS backend is not ready", "error", ErrReadyCheckTimeout, "timeout", ReadyCheckTimeout)
+		}
+		return started, false, fmt.Errorf("%w after %s", ErrReadyCheckTimeout, ReadyCheckTimeout)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.checked, false, r.err
+}
+
+// run asks the backend and stores the result, unless a reload replaced the service in the meantime.
+func (r *readiness) run(service dns.DynDNSService, done chan struct{}) {
+	defer close(done)
+
+	err := service.CheckHealth()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running == done {
+		r.running, r.runningFor = nil, nil
+	}
+
+	if r.runningFor != nil && r.runningFor != service {
+		return
+	}
+
+	if err != nil && (r.err == nil || r.service != service) {
+		slog.Warn("DNS backend is not ready", "error", err)
+	} else if err == nil && (r.timedOut || (r.err != nil && r.service == service)) {
+		slog.Info("DNS backend is ready again")
+	}
+
+	r.service, r.checked, r.err, r.timedOut = service, time.Now(), err, false
+}
+
+// MountHealthRoutes serves the probes of Kubernetes and Docker. /healthz only tells that the process answers, /readyz
+// also checks with a cheap read that the DNS backend is reachable and accepts the credentials. The result of the
+// check is reused for cfg.ReadyCheckInterval.
+func MountHealthRoutes(e *echo.Echo, config ConfigFunc) {
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, HealthResult{Status: HealthOK})
+	})
+
+	ready := &readiness{}
+
+	e.GET("/readyz", func(c echo.Context) error {
+		cfg := config(c)
+
+		checked, cached, err := ready.check(cfg.CloudDNS, cfg.ReadyCheckInterval)
+
+		result := HealthResult{
+			Status:    HealthOK,
+			Provider:  cfg.Provider,
+			CheckedAt: &checked,
+			Cached:    cached,
+		}
+
+		if err != nil {
+			result.Status = HealthUnavailable
+			result.Error = err.Error()
+			return c.JSON(http.StatusServiceUnavailable, result)
+		}
+
+		return c.JSON(http.StatusOK, result)
+	})
+}
@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/history"
+	"dyndns/pkg/ratelimit"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MountHistoryRoute serves the recorded record changes, newest first. A user limited to some hostnames only sees
+// their entries.
+func MountHistoryRoute(e *echo.Echo, config ConfigFunc) {
+	e.GET("/history", func(c echo.Context) error {
+		cfg := config(c)
+
+		if cfg.History == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error":  "History is disabled",
+				"detail": "Start the server with --history-file to record the history",
+			})
+		}
+
+		if !limitRequest(c, cfg, ratelimit.ClassRead) {
+			return tooManyRequests(c)
+		}
+
+		user, _ := c.Get(auth.ContextKeyUser).(*auth.User)
+
+		query := history.Query{
+			Cursor: c.QueryParam("cursor"),
+		}
+
+		if hostname := strings.ToLower(strings.TrimSpace(c.QueryParam("hostname"))); hostname != "" {
+			// Hostnames the server no longer manages keep their history, so only the zone is checked
+			qualified, err := cfg.qualifyHostname(hostname)
+
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":  err.Error(),
+					"detail": "Provide a hostname (hostname) inside the zone " + cfg.Zone + " or omit it to list all hostnames",
+				})
+			}
+
+			if user != nil && !user.MayUpdate(qualified) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error":  ErrHostnameForbidden.Error(),
+					"detail": "User " + user.Name + " may not see the history of " + qualified,
+				})
+			}
+
+			query.Hostname = qualified
+		}
+
+		if since := c.QueryParam("since"); since != "" {
+			parsed, err := parseSince(since)
+
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":  "Invalid since",
+					"detail": "Provide the start (since) as RFC 3339 time, e.g. 2024-01-02T15:04:05Z, or as duration before now, e.g. 24h",
+				})
+			}
+
+			query.Since = parsed
+		}
+
+		if limit := c.QueryParam("limit"); limit != "" {
+			parsed, err := strconv.Atoi(limit)
+
+			if err != nil || parsed <= 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":  "Invalid limit",
+					"detail": "Provide the page size (limit) between 1 and " + strconv.Itoa(history.MaxLimit),
+				})
+			}
+
+			query.Limit = parsed
+		}
+
+		// A user allowed every hostname sees the entries without a hostname as well
+		if user != nil && !slices.Contains(user.Hostnames, "*") {
+			query.MatchHostname = user.MayUpdate
+		}
+
+		page, err := cfg.History.Query(query)
+
+		if errors.Is(err, history.ErrInvalidCursor) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":  err.Error(),
+				"detail": "Provide the cursor (cursor) returned as next by the previous page",
+			})
+		}
+
+		if err != nil {
+			RequestLogger(c).Error("Failed to query history", "error", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error":  "Failed to query history",
+				"detail": "See the log of the server",
+			})
+		}
+
+		return c.JSON(http.StatusOK, page)
+	})
+}
+
+// parseSince accepts an RFC 3339 time or a duration counted back from now.
+func parseSince(since string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, since); err == nil {
+		return parsed, nil
+	}
+
+	duration, err := time.ParseDuration(since)
+
+	if err != nil || duration < 0 {
+		return time.Time{}, errors.New("invalid since")
+	}
+
+	return time.Now().Add(-duration), nil
+}
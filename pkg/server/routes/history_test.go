@@ -0,0 +1,167 @@
+package routes_test
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/history"
+	"dyndns/pkg/server/routes"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newHistoryServer serves /history of a store holding one entry per hostname, newest last, as if user had
+// authenticated. A nil user is the server without users.
+func newHistoryServer(t *testing.T, user *auth.User, hostnames ...string) *echo.Echo {
+	t.Helper()
+
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"), 0)
+
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	t.Cleanup(func() { _ = store.Close() })
+
+	for _, hostname := range hostnames {
+		if err := store.Add(history.Entry{Hostname: hostname, Outcome: "created"}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	cfg, _ := newTestConfig(dns.MemoryOptions{})
+	cfg.History = store
+
+	e := echo.New()
+
+	if user != nil {
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set(auth.ContextKeyUser, user)
+				return next(c)
+			}
+		})
+	}
+
+	routes.MountHistoryRoute(e, func(echo.Context) *routes.Config { return cfg })
+
+	return e
+}
+
+func queryHistory(t *testing.T, e *echo.Echo, target string) history.Page {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s, want 200", rec.Code, rec.Body.String())
+	}
+
+	var page history.Page
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+
+	return page
+}
+
+// hostnames returns the hostnames of the entries of page, e.g. "b,a".
+func hostnames(page history.Page) string {
+	var hostnames []string
+
+	for _, entry := range page.Entries {
+		hostnames = append(hostnames, strings.TrimSuffix(entry.Hostname, "."+testZone))
+	}
+
+	return strings.Join(hostnames, ",")
+}
+
+func TestHistoryUserFilter(t *testing.T) {
+	recorded := []string{"home.example.com.", "office.example.com.", "", "cabin.example.com.", "home.example.com."}
+
+	tests := []struct {
+		name      string
+		hostnames []string
+		want      string
+	}{
+		{name: "single hostname", hostnames: []string{"home.example.com."}, want: "home,home"},
+		{name: "glob", hostnames: []string{"*.example.com."}, want: "home,cabin,office,home"},
+		{name: "every hostname", hostnames: []string{"*"}, want: "home,cabin,,office,home"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := auth.NewStore()
+			_ = store.Add("alice", "secret", tt.hostnames)
+			user, _ := store.Authenticate("alice", "secret")
+
+			e := newHistoryServer(t, user, recorded...)
+
+			if got := hostnames(queryHistory(t, e, "/history")); got != tt.want {
+				t.Fatalf("entries = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryUserFilterPages(t *testing.T) {
+	store := auth.NewStore()
+	_ = store.Add("alice", "secret", []string{"home.example.com.", "cabin.example.com."})
+	user, _ := store.Authenticate("alice", "secret")
+
+	e := newHistoryServer(t, user, "home.example.com.", "office.example.com.", "cabin.example.com.", "office.example.com.", "home.example.com.")
+
+	page := queryHistory(t, e, "/history?limit=2")
+
+	if hostnames(page) != "home,cabin" || page.Next == "" {
+		t.Fatalf("page 1 = %s next %q, want home,cabin with a next page", hostnames(page), page.Next)
+	}
+
+	page = queryHistory(t, e, "/history?limit=2&cursor="+page.Next)
+
+	if hostnames(page) != "home" || page.Next != "" {
+		t.Fatalf("page 2 = %s next %q, want home", hostnames(page), page.Next)
+	}
+}
+
+func TestHistoryForbiddenHostname(t *testing.T) {
+	store := auth.NewStore()
+	_ = store.Add("alice", "secret", []string{"home.example.com."})
+	user, _ := store.Authenticate("alice", "secret")
+
+	e := newHistoryServer(t, user, "office.example.com.")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?hostname=office", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d %s, want 403", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	e := newHistoryServer(t, nil, "home.example.com.", "office.example.com.", "home.example.com.")
+
+	if got := hostnames(queryHistory(t, e, "/history?hostname=office")); got != "office" {
+		t.Fatalf("entries = %s, want office", got)
+	}
+
+	if got := hostnames(queryHistory(t, e, "/history?since=1h")); got != "home,office,home" {
+		t.Fatalf("entries = %s, want all", got)
+	}
+
+	for _, target := range []string{"/history?since=yesterday", "/history?limit=0", "/history?cursor=abc", "/history?hostname=example.org"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s status = %d, want 400", target, rec.Code)
+		}
+	}
+}
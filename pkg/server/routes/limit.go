@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/metrics"
+	"dyndns/pkg/ratelimit"
+	"github.com/labstack/echo/v4"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// limitRequest takes a token of class from the buckets of the client address and the authenticated user. A user with
+// own limits draws from buckets of their own. If a bucket is empty it rejects the request, sets Retry-After and
+// returns false. It runs before the request is validated, so invalid requests are charged as well.
+func limitRequest(c echo.Context, cfg *Config, class string) bool {
+	user, _ := c.Get(auth.ContextKeyUser).(*auth.User)
+
+	return allowRequest(c, cfg, class, nil, func(prefix string) []string {
+		keys := []string{prefix + "ip:" + c.RealIP()}
+
+		if user != nil {
+			keys = append(keys, prefix+"user:"+user.Name)
+		}
+
+		return keys
+	})
+}
+
+// limitHostnames takes a token of class from the bucket of each of hostnames like limitRequest. The hostnames must
+// have been authorized, otherwise anyone could drain the bucket of a hostname they may not change.
+func limitHostnames(c echo.Context, cfg *Config, class string, hostnames []string) bool {
+	return allowRequest(c, cfg, class, hostnames, func(prefix string) []string {
+		var keys []string
+		seen := map[string]bool{}
+
+		for _, hostname := range hostnames {
+			hostname = strings.ToLower(hostname)
+
+			if !seen[hostname] {
+				seen[hostname] = true
+				keys = append(keys, prefix+"host:"+hostname)
+			}
+		}
+
+		return keys
+	})
+}
+
+// allowRequest takes a token from the buckets named by keys under the limit of class. Rejected requests are logged
+// and counted, but not recorded in the history, so a flood of them cannot crowd out the real changes.
+func allowRequest(c echo.Context, cfg *Config, class string, hostnames []string, keys func(prefix string) []string) bool {
+	if cfg.Limiter == nil {
+		return true
+	}
+
+	limit := cfg.WriteLimit
+	if class == ratelimit.ClassRead {
+		limit = cfg.ReadLimit
+	}
+
+	prefix := class + "|"
+
+	if user, ok := c.Get(auth.ContextKeyUser).(*auth.User); ok {
+		if own := user.Limits.For(class); own != nil {
+			limit = *own
+			prefix = class + "|" + user.Name + "|"
+		}
+	}
+
+	if limit.Unlimited() {
+		return true
+	}
+
+	allowed, wait := cfg.Limiter.Allow(limit, keys(prefix)...)
+
+	if allowed {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+
+	fields := []any{"outcome", OutcomeRejected, "reason", ReasonRateLimited, "limit", limit.String(), "retry_after", retryAfter}
+
+	if len(hostnames) > 0 {
+		fields = append(fields, "hostname", strings.Join(hostnames, ","))
+	}
+
+	metrics.ValidationError(c.Path(), ReasonRateLimited)
+	RequestLogger(c).Warn("Rate limit exceeded", fields...)
+
+	return false
+}
+
+// tooManyRequests is the JSON response of a request rejected by limitRequest.
+func tooManyRequests(c echo.Context) error {
+	return c.JSON(http.StatusTooManyRequests, map[string]string{
+		"error":  "Rate limit exceeded",
+		"detail": "Retry after " + c.Response().Header().Get(echo.HeaderRetryAfter) + " seconds",
+	})
+}
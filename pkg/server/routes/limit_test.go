@@ -0,0 +1,134 @@
+package routes_test
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/ratelimit"
+	"dyndns/pkg/server/routes"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newLimitedConfig(write ratelimit.Limit) (*routes.Config, *dns.MemoryService) {
+	cfg, service := newTestConfig(dns.MemoryOptions{})
+	cfg.Limiter = ratelimit.NewLimiter()
+	cfg.WriteLimit = write
+	return cfg, service
+}
+
+func assertTooManyRequests(t *testing.T, rec *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d %s, want 429", rec.Code, rec.Body.String())
+	}
+
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+
+	if err != nil || retryAfter <= 0 {
+		t.Fatalf("Retry-After = %q, want a positive number of seconds", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestDynRateLimited(t *testing.T) {
+	cfg, _ := newLimitedConfig(ratelimit.Limit{Count: 1, Period: time.Minute})
+	e := newTestServer(cfg)
+
+	decodeUpdateResult(t, serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1"))
+
+	rec := serve(e, http.MethodGet, "/dyn?ip_address=1.0.0.1")
+	assertTooManyRequests(t, rec)
+
+	var body map[string]string
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] != "Rate limit exceeded" || body["detail"] != "Retry after "+rec.Header().Get("Retry-After")+" seconds" {
+		t.Fatalf("body = %s, want the rate limit error", rec.Body.String())
+	}
+}
+
+func TestDynRateLimitChargesInvalidRequests(t *testing.T) {
+	cfg, service := newLimitedConfig(ratelimit.Limit{Count: 1, Period: time.Minute})
+	e := newTestServer(cfg)
+
+	if rec := serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1&ttl=abc"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+
+	// The address bucket is charged before the request is validated
+	assertTooManyRequests(t, serve(e, http.MethodGet, "/dyn?ip_address=1.1.1.1"))
+	assertMemoryRecord(t, service, testDomainName, "A", "")
+}
+
+// serveFrom serves a request sent from remoteAddr, so it draws from the bucket of another client address.
+func serveFrom(e *echo.Echo, remoteAddr string, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDynRateLimitPerHostname(t *testing.T) {
+	cfg, _ := newLimitedConfig(ratelimit.Limit{Count: 1, Period: time.Minute})
+	e := newTestServer(cfg)
+
+	decodeUpdateResult(t, serveFrom(e, "8.8.8.8:1234", "/dyn?ip_address=1.1.1.1"))
+
+	// Another client with a bucket of its own is still limited by the bucket of the hostname
+	assertTooManyRequests(t, serveFrom(e, "8.8.4.4:1234", "/dyn?ip_address=1.0.0.1"))
+
+	decodeUpdateResult(t, serveFrom(e, "9.9.9.9:1234", "/dyn?ip_address=1.0.0.1&hostname=office"))
+}
+
+func TestNicAbuse(t *testing.T) {
+	cfg, _ := newLimitedConfig(ratelimit.Limit{Count: 1, Period: time.Minute})
+	e := newTestServer(cfg)
+
+	if rec := serveFrom(e, "8.8.8.8:1234", "/nic/update?myip=1.1.1.1&hostname=home.example.com"); rec.Code != http.StatusOK || rec.Body.String() != "good 1.1.1.1" {
+		t.Fatalf("response = %d %q, want good", rec.Code, rec.Body.String())
+	}
+
+	// Only the bucket of home is empty, office is still updated
+	if rec := serveFrom(e, "8.8.4.4:1234", "/nic/update?myip=1.1.1.1&hostname=home.example.com,office.example.com"); rec.Code != http.StatusOK || rec.Body.String() != "abuse\ngood 1.1.1.1" {
+		t.Fatalf("response = %d %q, want abuse for home only", rec.Code, rec.Body.String())
+	}
+
+	// Every hostname is limited
+	rec := serveFrom(e, "9.9.9.9:1234", "/nic/update?myip=1.1.1.1&hostname=home.example.com,office.example.com")
+	assertTooManyRequests(t, rec)
+
+	if rec.Body.String() != "abuse\nabuse" {
+		t.Fatalf("body = %q, want abuse for both hostnames", rec.Body.String())
+	}
+
+	// The bucket of the address is empty, the request is rejected before its hostnames are looked at
+	rec = serveFrom(e, "8.8.8.8:1234", "/nic/update?myip=1.1.1.1&hostname=office.example.com")
+	assertTooManyRequests(t, rec)
+
+	if rec.Body.String() != "abuse" {
+		t.Fatalf("body = %q, want abuse", rec.Body.String())
+	}
+}
+
+func TestRateLimitOwnUserLimits(t *testing.T) {
+	cfg, _ := newLimitedConfig(ratelimit.Limit{Count: 1, Period: time.Minute})
+	cfg.Users = auth.NewStore()
+	_ = cfg.Users.AddUser(&auth.User{Name: "alice", Hostnames: []string{"*"}, Limits: ratelimit.Limits{Write: &ratelimit.Limit{}}}, "secret")
+	e := newTestServer(cfg)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?myip=1.1.1.1&hostname=home.example.com", nil)
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d %q, want the unlimited user allowed", i+1, rec.Code, rec.Body.String())
+		}
+	}
+}
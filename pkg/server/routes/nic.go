@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/metrics"
+	"dyndns/pkg/ratelimit"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Return codes of the dyndns2 protocol.
+const (
+	NicGood     = "good"
+	NicNoChange = "nochg"
+	NicBadAuth  = "badauth"
+	NicNoHost   = "nohost"
+	NicNotFQDN  = "notfqdn"
+	NicAbuse    = "abuse"
+	NicError    = "911"
+)
+
+// MountNicRoute serves the dyndns2 protocol spoken by stock routers and ddclient. It authenticates against
+// cfg.Users itself, because the clients expect a plain-text badauth instead of the JSON error of the middleware.
+func MountNicRoute(e *echo.Echo, config ConfigFunc) {
+	e.GET("/nic/update", func(c echo.Context) error {
+		cfg := config(c)
+
+		var user *auth.User
+
+		if cfg.Users != nil && cfg.Users.Len() > 0 {
+			username, password, ok := c.Request().BasicAuth()
+
+			if ok {
+				user, ok = cfg.Users.Authenticate(username, password)
+			}
+
+			if !ok {
+				RequestLogger(c).Warn("Bad authentication", "user", username, "outcome", "badauth")
+				metrics.AuthFailure(c.Path())
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="DynDNS"`)
+				return c.String(http.StatusUnauthorized, NicBadAuth)
+			}
+
+			c.Set(auth.ContextKeyUser, user)
+		}
+
+		hostnames := strings.Split(c.QueryParam("hostname"), ",")
+
+		if !limitRequest(c, cfg, ratelimit.ClassWrite) {
+			return c.String(http.StatusTooManyRequests, strings.TrimSuffix(strings.Repeat(NicAbuse+"\n", len(hostnames)), "\n"))
+		}
+
+		myIP := c.QueryParam("myip")
+		if myIP == "" {
+			myIP = c.RealIP()
+		}
+
+		var lines []string
+		status := http.StatusTooManyRequests
+
+		for _, hostname := range hostnames {
+			line := nicUpdate(c, cfg, user, hostname, myIP)
+
+			if line != NicAbuse {
+				status = http.StatusOK
+			}
+
+			lines = append(lines, line)
+		}
+
+		return c.String(status, strings.Join(lines, "\n"))
+	})
+}
+
+func nicUpdate(c echo.Context, cfg *Config, user *auth.User, hostname string, myIP string) string {
+
+	// dyndns2 has no default hostname, clients always have to name the record
+	if strings.TrimSpace(hostname) == "" {
+		reject(c, cfg, target{}, errorReason(ErrHostnameInvalid), "No hostname provided")
+		return NicNotFQDN
+	}
+
+	resolved, err := cfg.ResolveHostname(hostname)
+
+	if err != nil {
+		reject(c, cfg, target{hostnames: []string{hostname}}, errorReason(err), "Invalid hostname", "error", err)
+	}
+
+	if errors.Is(err, ErrHostnameInvalid) {
+		return NicNotFQDN
+	}
+
+	if err != nil {
+		return NicNoHost
+	}
+
+	if user != nil && !user.MayUpdate(resolved) {
+		reject(c, cfg, target{hostnames: []string{resolved}}, errorReason(ErrHostnameForbidden), "Hostname forbidden", "user", user.Name)
+		return NicNoHost
+	}
+
+	if !limitHostnames(c, cfg, ratelimit.ClassWrite, []string{resolved}) {
+		return NicAbuse
+	}
+
+	v4Address, v6Address, err := parseMyIP(myIP)
+
+	if err != nil {
+		reject(c, cfg, target{hostnames: []string{resolved}, value: myIP}, ReasonInvalidAddress, "Invalid IP address", "error", err)
+		// dyndns2 has no code for a bad address, notfqdn is the client error routers do not retry
+		return NicNotFQDN
+	}
+
+	var addresses []string
+
+	for _, address := range []struct {
+		rrType string
+		value  string
+		v6     bool
+	}{{"A", v4Address, false}, {"AAAA", v6Address, true}} {
+		if address.value == "" {
+			continue
+		}
+
+		parsed, err := validateAddress(address.value, address.v6)
+
+		if err != nil {
+			reject(c, cfg, target{hostnames: []string{resolved}, rrType: address.rrType, value: address.value}, ReasonInvalidAddress, "Invalid IP address", "error", err)
+			return NicNotFQDN
+		}
+
+		addresses = append(addresses, parsed.String())
+	}
+
+	// dyndns2 clients cannot choose a TTL, so the configured default of the hostname applies
+	ttl, _ := cfg.ResolveTTL(resolved, "")
+
+	v4Result, v6Result := cfg.CloudDNS.UpdateDNSRecord(resolved, v4Address, v6Address, ttl)
+
+	reportResult(c, cfg, resolved, v4Result)
+	reportResult(c, cfg, resolved, v6Result)
+
+	unchanged := true
+
+	for _, result := range []struct {
+		rrType  string
+		address string
+		result  *dns.UpdateResult
+	}{{"A", v4Address, v4Result}, {"AAAA", v6Address, v6Result}} {
+		if result.address == "" {
+			continue
+		}
+
+		if err := resultError(result.result); err != nil {
+			if result.result == nil { // Results of the provider were already reported
+				RequestLogger(c).Error("DNS record write failed", "hostname", resolved, "rr_type", result.rrType, "ip", result.address, "outcome", metrics.OutcomeError, "error", err)
+			}
+			return NicError
+		}
+
+		if !result.result.Unchanged {
+			unchanged = false
+		}
+	}
+
+	if unchanged {
+		return NicNoChange + " " + strings.Join(addresses, ",")
+	}
+
+	return NicGood + " " + strings.Join(addresses, ",")
+}
+
+// parseMyIP splits the myip parameter into its IPv4 and IPv6 address. Each family may appear at most once, so a
+// client listing several addresses learns about it instead of having one of them picked.
+func parseMyIP(myIP string) (string, string, error) {
+	var v4Address, v6Address string
+
+	for _, address := range strings.Split(myIP, ",") {
+		parsed := net.ParseIP(strings.TrimSpace(address))
+
+		switch {
+		case parsed == nil:
+			return "", "", fmt.Errorf("invalid IP address %q", strings.TrimSpace(address))
+		case parsed.To4() != nil && v4Address != "":
+			return "", "", errors.New("more than one IPv4 address")
+		case parsed.To4() != nil:
+			v4Address = parsed.String()
+		case v6Address != "":
+			return "", "", errors.New("more than one IPv6 address")
+		default:
+			v6Address = parsed.String()
+		}
+	}
+
+	return v4Address, v6Address, nil
+}
+
+func resultError(result *dns.UpdateResult) error {
+	if result == nil {
+		return errors.New("no result from DNS service")
+	}
+
+	if !result.Success && result.Error == nil {
+		return errors.New("DNS record not updated")
+	}
+
+	return result.Error
+}
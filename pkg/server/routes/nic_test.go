@@ -0,0 +1,135 @@
+package routes_test
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/ratelimit"
+	"dyndns/pkg/server/routes"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNicUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		user     string
+		password string
+		setup    func(cfg *routes.Config, service *dns.MemoryService, e *echo.Echo)
+		status   int
+		want     string
+	}{
+		{name: "good", query: "hostname=home.example.com&myip=1.1.1.1", status: http.StatusOK, want: "good 1.1.1.1"},
+		{name: "good mixed families", query: "hostname=home.example.com&myip=1.1.1.1,2001:db8::1", status: http.StatusOK, want: "good 1.1.1.1,2001:db8::1"},
+		{name: "good relative hostname", query: "hostname=home.&myip=1.1.1.1", status: http.StatusOK, want: "good 1.1.1.1"},
+		{name: "good address of the client", query: "hostname=home.example.com", status: http.StatusOK, want: "good 8.8.8.8"},
+		{
+			name:  "nochg",
+			query: "hostname=home.example.com&myip=1.1.1.1",
+			setup: func(cfg *routes.Config, service *dns.MemoryService, e *echo.Echo) {
+				service.UpdateDNSRecord(testDomainName, "1.1.1.1", "", 0)
+			},
+			status: http.StatusOK,
+			want:   "nochg 1.1.1.1",
+		},
+		{
+			name:  "nochg mixed families",
+			query: "hostname=home.example.com&myip=2001:db8::1,1.1.1.1",
+			setup: func(cfg *routes.Config, service *dns.MemoryService, e *echo.Echo) {
+				service.UpdateDNSRecord(testDomainName, "1.1.1.1", "2001:db8::1", 0)
+			},
+			status: http.StatusOK,
+			want:   "nochg 1.1.1.1,2001:db8::1",
+		},
+		{
+			name:  "good if one family changed",
+			query: "hostname=home.example.com&myip=1.1.1.1,2001:db8::2",
+			setup: func(cfg *routes.Config, service *dns.MemoryService, e *echo.Echo) {
+				service.UpdateDNSRecord(testDomainName, "1.1.1.1", "2001:db8::1", 0)
+			},
+			status: http.StatusOK,
+			want:   "good 1.1.1.1,2001:db8::2",
+		},
+		{name: "badauth wrong password", query: "hostname=home.example.com&myip=1.1.1.1", user: "alice", password: "wrong", status: http.StatusUnauthorized, want: "badauth"},
+		{name: "badauth unknown user", query: "hostname=home.example.com&myip=1.1.1.1", user: "mallory", password: "secret", status: http.StatusUnauthorized, want: "badauth"},
+		{name: "badauth no credentials", query: "hostname=home.example.com&myip=1.1.1.1", user: "-", status: http.StatusUnauthorized, want: "badauth"},
+		{name: "nohost not managed", query: "hostname=other.example.com&myip=1.1.1.1", status: http.StatusOK, want: "nohost"},
+		{name: "nohost outside the zone", query: "hostname=home.example.org&myip=1.1.1.1", status: http.StatusOK, want: "nohost"},
+		{name: "nohost forbidden for the user", query: "hostname=home.example.com&myip=1.1.1.1", user: "bob", password: "secret", status: http.StatusOK, want: "nohost"},
+		{name: "notfqdn no hostname", query: "myip=1.1.1.1", status: http.StatusOK, want: "notfqdn"},
+		{name: "notfqdn malformed hostname", query: "hostname=home..example.com&myip=1.1.1.1", status: http.StatusOK, want: "notfqdn"},
+		{name: "notfqdn malformed myip", query: "hostname=home.example.com&myip=bogus", status: http.StatusOK, want: "notfqdn"},
+		{name: "notfqdn two IPv4 addresses", query: "hostname=home.example.com&myip=1.1.1.1,1.0.0.1", status: http.StatusOK, want: "notfqdn"},
+		{name: "notfqdn two IPv6 addresses", query: "hostname=home.example.com&myip=2001:db8::1,2001:db8::2", status: http.StatusOK, want: "notfqdn"},
+		{name: "notfqdn unusable address", query: "hostname=home.example.com&myip=1.1.1.1,fe80::1", status: http.StatusOK, want: "notfqdn"},
+		{
+			name:  "abuse",
+			query: "hostname=home.example.com&myip=1.1.1.1",
+			setup: func(cfg *routes.Config, service *dns.MemoryService, e *echo.Echo) {
+				cfg.Limiter = ratelimit.NewLimiter()
+				cfg.WriteLimit = ratelimit.Limit{Count: 1, Period: time.Minute}
+				serveNic(e, "alice", "secret", "hostname=home.example.com&myip=1.1.1.1")
+			},
+			status: http.StatusTooManyRequests,
+			want:   "abuse",
+		},
+		{
+			name:  "911",
+			query: "hostname=home.example.com&myip=1.1.1.1,2001:db8::1",
+			setup: func(cfg *routes.Config, service *dns.MemoryService, e *echo.Echo) {
+				service.SetOptions(dns.MemoryOptions{Fail: []string{dns.MemoryOperationCreate}})
+			},
+			status: http.StatusOK,
+			want:   "911",
+		},
+		{
+			name:   "one line per hostname",
+			query:  "hostname=home.example.com,other.example.com,office.example.com&myip=1.1.1.1",
+			status: http.StatusOK,
+			want:   "good 1.1.1.1\nnohost\ngood 1.1.1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, service := newTestConfig(dns.MemoryOptions{})
+			cfg.Users = auth.NewStore()
+			_ = cfg.Users.Add("alice", "secret", []string{"home.example.com.", "office.example.com."})
+			_ = cfg.Users.Add("bob", "secret", []string{"office.example.com."})
+			e := newTestServer(cfg)
+
+			if tt.setup != nil {
+				tt.setup(cfg, service, e)
+			}
+
+			user, password := tt.user, tt.password
+
+			if user == "" {
+				user, password = "alice", "secret"
+			}
+
+			rec := serveNic(e, user, password, tt.query)
+
+			if rec.Code != tt.status || rec.Body.String() != tt.want {
+				t.Fatalf("response = %d %q, want %d %q", rec.Code, rec.Body.String(), tt.status, tt.want)
+			}
+		})
+	}
+}
+
+// serveNic sends a dyndns2 update from 8.8.8.8 as user, without credentials if user is "-".
+func serveNic(e *echo.Echo, user string, password string, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?"+query, nil)
+	req.RemoteAddr = "8.8.8.8:1234"
+
+	if user != "-" {
+		req.SetBasicAuth(user, password)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
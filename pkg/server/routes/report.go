@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/history"
+	"dyndns/pkg/metrics"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"strings"
+)
+
+// Reasons of dyndns_validation_errors_total that are not derived from an error.
+const (
+	ReasonNoAddress      = "no_address"
+	ReasonInvalidAddress = "invalid_address"
+	ReasonInvalidFamily  = "invalid_family"
+	ReasonRateLimited    = "rate_limited"
+)
+
+// OutcomeRejected is logged for requests and records refused before they reached the DNS provider.
+const OutcomeRejected = "rejected"
+
+// RequestLogger returns the logger for a request, carrying the request ID, the address of the client and the route.
+func RequestLogger(c echo.Context) *slog.Logger {
+	return slog.With(
+		"request_id", c.Response().Header().Get(echo.HeaderXRequestID),
+		"remote_ip", c.RealIP(),
+		"route", c.Path(),
+	)
+}
+
+// target is what is known about the records a rejected request aimed at. rrType is empty if the request was rejected
+// for both families.
+type target struct {
+	hostnames []string
+	rrType    string
+	value     string
+}
+
+// reject logs, counts and records in the history a request or record refused before it reached the DNS provider.
+func reject(c echo.Context, cfg *Config, t target, reason string, msg string, args ...any) {
+	metrics.ValidationError(c.Path(), reason)
+
+	fields := []any{"outcome", OutcomeRejected, "reason", reason}
+
+	if len(t.hostnames) > 0 {
+		fields = append(fields, "hostname", strings.Join(t.hostnames, ","))
+	}
+
+	if t.rrType != "" {
+		fields = append(fields, "rr_type", t.rrType)
+	}
+
+	if t.value != "" {
+		fields = append(fields, "ip", t.value)
+	}
+
+	RequestLogger(c).Warn(msg, append(fields, args...)...)
+
+	if len(t.hostnames) == 0 {
+		t.hostnames = []string{""}
+	}
+
+	for _, hostname := range t.hostnames {
+		record(c, cfg, history.Entry{
+			Hostname: hostname,
+			RRType:   t.rrType,
+			Value:    t.value,
+			Outcome:  OutcomeRejected,
+			Reason:   reason,
+		})
+	}
+}
+
+// requestedHostnames returns the hostnames named by the hostname query parameter for a request rejected before they
+// were checked. Names the server does not manage are kept as sent.
+func requestedHostnames(c echo.Context, cfg *Config) []string {
+	var hostnames []string
+
+	for _, hostname := range strings.Split(c.QueryParam("hostname"), ",") {
+		if resolved, err := cfg.ResolveHostname(hostname); err == nil {
+			hostname = resolved
+		}
+		hostnames = append(hostnames, hostname)
+	}
+
+	return hostnames
+}
+
+// record adds entry to the history, filling in who sent the request. Without a history it does nothing.
+func record(c echo.Context, cfg *Config, entry history.Entry) {
+	if cfg.History == nil {
+		return
+	}
+
+	entry.ClientIP = c.RealIP()
+	entry.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	entry.Route = c.Path()
+
+	if user, ok := c.Get(auth.ContextKeyUser).(*auth.User); ok {
+		entry.User = user.Name
+	}
+
+	if err := cfg.History.Add(entry); err != nil {
+		RequestLogger(c).Error("Failed to record history", "hostname", entry.Hostname, "error", err)
+	}
+}
+
+// reportResult logs, counts and records in the history the outcome of a record write. Results of families that were
+// not requested are nil.
+func reportResult(c echo.Context, cfg *Config, hostname string, result *dns.UpdateResult) {
+	if result == nil {
+		return
+	}
+
+	outcome := metrics.OutcomeError
+
+	switch {
+	case result.Error != nil || !result.Success:
+	case result.Created:
+		outcome = metrics.OutcomeCreated
+	case result.Updated:
+		outcome = metrics.OutcomeUpdated
+	case result.Deleted:
+		outcome = metrics.OutcomeDeleted
+	default:
+		outcome = metrics.OutcomeUnchanged
+	}
+
+	metrics.ObserveRecord(c.Path(), hostname, result.RRType, outcome, result.Value)
+
+	logger := RequestLogger(c).With("hostname", hostname, "rr_type", result.RRType, "outcome", outcome)
+
+	switch outcome {
+	case metrics.OutcomeError:
+		logger.Error("DNS record write failed", "ip", result.Value, "error", resultError(result))
+	case metrics.OutcomeCreated:
+		logger.Info("DNS record created", "ip", result.Value, "ttl", result.TTL)
+	case metrics.OutcomeUpdated:
+		logger.Info("DNS record updated", "ip", result.Value, "previous_ip", result.PreviousValue, "ttl", result.TTL)
+	case metrics.OutcomeDeleted:
+		logger.Info("DNS record deleted", "ip", result.PreviousValue)
+	default:
+		logger.Debug("DNS record unchanged", "ip", result.Value)
+	}
+
+	entry := history.Entry{
+		Hostname:      hostname,
+		RRType:        result.RRType,
+		PreviousValue: result.PreviousValue,
+		Value:         result.Value,
+		TTL:           result.TTL,
+		Outcome:       outcome,
+	}
+
+	if outcome == metrics.OutcomeError {
+		entry.Error = resultError(result).Error()
+	}
+
+	record(c, cfg, entry)
+}
+
+// errorReason maps the validation errors of the routes to the reason label of dyndns_validation_errors_total.
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrHostnameNotInZone):
+		return "hostname_not_in_zone"
+	case errors.Is(err, ErrHostnameNotAllowed):
+		return "hostname_not_allowed"
+	case errors.Is(err, ErrHostnameInvalid):
+		return "hostname_invalid"
+	case errors.Is(err, ErrHostnameForbidden):
+		return "hostname_forbidden"
+	case errors.Is(err, ErrTTLInvalid):
+		return "ttl_invalid"
+	case errors.Is(err, ErrTTLOutOfRange):
+		return "ttl_out_of_range"
+	}
+
+	return "other"
+}
@@ -1,8 +1,130 @@
 package routes
 
-import "dyndns/pkg/dns"
+import (
+	"dyndns/pkg/auth"
+	"dyndns/pkg/dns"
+	"dyndns/pkg/history"
+	"dyndns/pkg/ratelimit"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrHostnameNotInZone  = errors.New("hostname is not inside the configured zone")
+	ErrHostnameNotAllowed = errors.New("hostname is not managed by this server")
+	ErrHostnameInvalid    = errors.New("invalid hostname")
+	ErrHostnameForbidden  = errors.New("user is not allowed to update this hostname")
+	ErrTTLInvalid         = errors.New("invalid TTL")
+	ErrTTLOutOfRange      = errors.New("TTL out of range")
+)
+
+// ConfigFunc returns the Config the request c is handled with. The server swaps the Config on reload, so a handler
+// fetches it once and uses it for the whole request.
+type ConfigFunc func(c echo.Context) *Config
 
 type Config struct {
+	// DomainName is updated when a request does not name a hostname.
 	DomainName string
-	CloudDNS   dns.DynDNSService
+	// Zone is the DNS zone all hostnames must lie in, e.g. "mydomain.tld.".
+	Zone string
+	// Hostnames lists the FQDNs clients may update. DomainName is always allowed.
+	Hostnames []string
+	CloudDNS  dns.DynDNSService
+	// Provider is the name of the provider behind CloudDNS, reported by /readyz.
+	Provider string
+	// ReadyCheckInterval is how long /readyz reuses the result of its backend check.
+	ReadyCheckInterval time.Duration
+	// TTL is used for hostnames without an entry in HostnameTTLs. 0 leaves the choice to the provider.
+	TTL int
+	// HostnameTTLs overrides TTL per FQDN.
+	HostnameTTLs map[string]int
+	// MinTTL and MaxTTL bound the ttl query parameter. 0 disables the bound.
+	MinTTL int
+	MaxTTL int
+	// History records every accepted and rejected record change. Nil disables the history.
+	History *history.Store
+	// Limiter rate limits the requests with ReadLimit and WriteLimit, unless the user has own limits. Nil disables
+	// rate limiting.
+	Limiter    *ratelimit.Limiter
+	ReadLimit  ratelimit.Limit
+	WriteLimit ratelimit.Limit
+	// Users authenticates the routes that check credentials themselves. Nil or empty disables authentication.
+	Users *auth.Store
+}
+
+// ResolveHostname turns the hostname query parameter into an FQDN managed by the server. Names without a dot are
+// taken relative to the zone, an empty name resolves to DomainName.
+func (c *Config) ResolveHostname(hostname string) (string, error) {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+
+	if hostname == "" {
+		return c.DomainName, nil
+	}
+
+	hostname, err := c.qualifyHostname(hostname)
+
+	if err != nil {
+		return "", err
+	}
+
+	if hostname == strings.ToLower(c.DomainName) {
+		return c.DomainName, nil
+	}
+
+	for _, allowed := range c.Hostnames {
+		if hostname == strings.ToLower(allowed) {
+			return allowed, nil
+		}
+	}
+
+	return "", ErrHostnameNotAllowed
+}
+
+// qualifyHostname turns a non-empty, lower-case hostname into an FQDN inside the zone, without checking that the
+// server manages it.
+func (c *Config) qualifyHostname(hostname string) (string, error) {
+	if strings.Contains(hostname, "..") || strings.HasPrefix(hostname, ".") || strings.ContainsAny(hostname, " /\\@:") {
+		return "", ErrHostnameInvalid
+	}
+
+	if !strings.Contains(strings.TrimSuffix(hostname, "."), ".") {
+		hostname = strings.TrimSuffix(hostname, ".") + "." + c.Zone
+	}
+
+	if !strings.HasSuffix(hostname, ".") {
+		hostname = hostname + "."
+	}
+
+	if hostname != c.Zone && !strings.HasSuffix(hostname, "."+c.Zone) {
+		return "", ErrHostnameNotInZone
+	}
+
+	return hostname, nil
+}
+
+// ResolveTTL returns the TTL for hostname. requested is the optional ttl query parameter and must lie within
+// MinTTL and MaxTTL, otherwise the per-hostname or server-wide default is used.
+func (c *Config) ResolveTTL(hostname string, requested string) (int, error) {
+	if requested == "" {
+		if ttl, ok := c.HostnameTTLs[strings.ToLower(hostname)]; ok {
+			return ttl, nil
+		}
+		return c.TTL, nil
+	}
+
+	ttl, err := strconv.Atoi(requested)
+
+	if err != nil || ttl <= 0 {
+		return 0, ErrTTLInvalid
+	}
+
+	if (c.MinTTL > 0 && ttl < c.MinTTL) || (c.MaxTTL > 0 && ttl > c.MaxTTL) {
+		return 0, fmt.Errorf("%w: allowed %d-%d", ErrTTLOutOfRange, c.MinTTL, c.MaxTTL)
+	}
+
+	return ttl, nil
 }
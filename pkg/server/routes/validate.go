@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"dyndns/pkg/utils"
+	"errors"
+	"net"
+)
+
+// validateAddress parses address and rejects everything that must not be published as A (v6 false) or AAAA
+// (v6 true) record. The returned IP is nil if the address could not be parsed.
+func validateAddress(address string, v6 bool) (net.IP, error) {
+	parsed := net.ParseIP(address)
+
+	if parsed == nil {
+		return nil, errors.New("invalid IP address")
+	}
+
+	if parsed.IsLoopback() {
+		return parsed, errors.New("loopback IP address")
+	}
+
+	if parsed.IsUnspecified() {
+		return parsed, errors.New("unspecified IP address")
+	}
+
+	if parsed.IsInterfaceLocalMulticast() {
+		return parsed, errors.New("interface-local multicast IP address")
+	}
+
+	if parsed.IsLinkLocalMulticast() {
+		return parsed, errors.New("link-local multicast IP address")
+	}
+
+	if parsed.IsMulticast() {
+		return parsed, errors.New("multicast IP address")
+	}
+
+	if parsed.IsLinkLocalUnicast() {
+		return parsed, errors.New("link-local unicast IP address")
+	}
+
+	if parsed.IsPrivate() {
+		return parsed, errors.New("private IP address")
+	}
+
+	if !v6 && parsed.To4() == nil {
+		return parsed, errors.New("IPv6 address")
+	}
+
+	if v6 && parsed.To4() != nil {
+		return parsed, errors.New("IPv4 address")
+	}
+
+	if utils.IsReservedOrUnroutableIP(parsed) {
+		return parsed, errors.New("reserved or unroutable IP address")
+	}
+
+	return parsed, nil
+}
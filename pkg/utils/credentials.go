@@ -16,30 +16,33 @@ func fileExists(filename string) bool {
 }
 
 func FindCredentials(filename string) ([]byte, error) {
-	if filename == "" {
-		return nil, CredentialFileNotFoundError
+	if strings.HasPrefix(filename, "env://") {
+		return []byte(os.Getenv(filename[6:])), nil
 	}
 
-	var path string
-	var found bool
+	path, err := FindCredentialsPath(filename)
 
-	if strings.HasPrefix(filename, "env://") {
-		return []byte(os.Getenv(filename[6:])), nil
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+// FindCredentialsPath returns the path FindCredentials reads filename from.
+func FindCredentialsPath(filename string) (string, error) {
+	if filename == "" || strings.HasPrefix(filename, "env://") {
+		return "", CredentialFileNotFoundError
 	}
 
 	var paths = []string{".", "..", "./credentials"}
 
 	for _, p := range paths {
-		path = p + "/" + filename
+		path := p + "/" + filename
 		if fileExists(path) {
-			found = true
-			break
+			return path, nil
 		}
 	}
 
-	if !found {
-		return nil, CredentialFileNotFoundError
-	}
-
-	return os.ReadFile(path)
+	return "", CredentialFileNotFoundError
 }
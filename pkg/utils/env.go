@@ -1,6 +1,9 @@
 package utils
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 func OsEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -9,3 +12,23 @@ func OsEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// OsEnvSecret works like OsEnv but falls back to the content of the file named by fileKey, which is how Docker and
+// Kubernetes hand out secrets. A trailing newline of the file is dropped.
+func OsEnvSecret(key, fileKey, defaultValue string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+
+	path := os.Getenv(fileKey)
+	if path == "" {
+		return defaultValue, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,66 @@
+package utils_test
+
+import (
+	"dyndns/pkg/utils"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOsEnvSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+
+	if err := os.WriteFile(secretFile, []byte("from file\r\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		filePath string
+		want     string
+	}{
+		{name: "variable", value: "from env", filePath: secretFile, want: "from env"},
+		{name: "file", filePath: secretFile, want: "from file"},
+		{name: "default", want: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DYNDNS_SECRET", tt.value)
+			t.Setenv("TEST_DYNDNS_SECRET_FILE", tt.filePath)
+
+			value, err := utils.OsEnvSecret("TEST_DYNDNS_SECRET", "TEST_DYNDNS_SECRET_FILE", "default")
+
+			if err != nil || value != tt.want {
+				t.Fatalf("OsEnvSecret = %q, %v, want %q", value, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOsEnvSecretMissingFile(t *testing.T) {
+	t.Setenv("TEST_DYNDNS_SECRET", "")
+	t.Setenv("TEST_DYNDNS_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := utils.OsEnvSecret("TEST_DYNDNS_SECRET", "TEST_DYNDNS_SECRET_FILE", "default"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestOsEnvSecretKeepsInnerNewlines(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+
+	if err := os.WriteFile(secretFile, []byte("line 1\nline 2\n\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	t.Setenv("TEST_DYNDNS_SECRET", "")
+	t.Setenv("TEST_DYNDNS_SECRET_FILE", secretFile)
+
+	if value, err := utils.OsEnvSecret("TEST_DYNDNS_SECRET", "TEST_DYNDNS_SECRET_FILE", ""); err != nil || value != "line 1\nline 2" {
+		t.Fatalf("OsEnvSecret = %q, %v, want %q", value, err, "line 1\nline 2")
+	}
+}